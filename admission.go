@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"io"
+	"math/rand"
+)
+
+// Admitter decides whether a candidate should be added to a full cache in
+// place of the victim which would be evicted for it.
+type Admitter interface {
+	Admit(candidate, victim Pair) bool
+}
+
+// AdmitterFunc adapts an ordinary function to an Admitter.
+type AdmitterFunc func(candidate, victim Pair) bool
+
+// Admit calls f(candidate, victim).
+func (f AdmitterFunc) Admit(candidate, victim Pair) bool {
+	return f(candidate, victim)
+}
+
+// TinyLFU is an Admitter which admits candidates estimated to be accessed more
+// frequently than their victims, as described by Einziger, Friedman, and Manes
+// in "TinyLFU: A Highly Efficient Cache Admission Policy". Frequencies are kept
+// in a CountMinSketch, which is aged by halving every counter after a sample
+// of ten times the capacity of accesses. A TinyLFU is not safe for concurrent
+// use.
+type TinyLFU struct {
+	sketch  *CountMinSketch
+	samples int
+	window  int
+}
+
+// NewTinyLFU constructs a new TinyLFU admitter for a cache of the given
+// capacity. This function panics if capacity <= 0.
+func NewTinyLFU(capacity int) *TinyLFU {
+	if capacity <= 0 {
+		panic("tinylfu: capacity <= 0")
+	}
+
+	return &TinyLFU{
+		sketch: NewCountMinSketch(capacity, 4),
+		window: 10 * capacity,
+	}
+}
+
+// Record an access of key. Accesses which do not reach Admit, such as cache
+// hits, should be recorded for frequency estimates to be accurate.
+func (t *TinyLFU) Record(key interface{}) {
+	t.sketch.Increment(key)
+	if t.samples++; t.samples >= t.window {
+		t.sketch.Reset()
+		t.samples /= 2
+	}
+}
+
+// Admit records an access of the candidate, and returns whether it is
+// estimated to be more frequently accessed than the victim.
+func (t *TinyLFU) Admit(candidate, victim Pair) bool {
+	t.Record(candidate.Key)
+	return t.sketch.Estimate(candidate.Key) > t.sketch.Estimate(victim.Key)
+}
+
+type probabilistic struct {
+	p float64
+	r *rand.Rand
+}
+
+// NewProbabilisticAdmitter constructs an Admitter which admits candidates with
+// probability p. Random numbers are read from rnd as in NewRR. This function
+// panics if p is not within [0, 1].
+func NewProbabilisticAdmitter(p float64, rnd io.Reader) Admitter {
+	if !(p >= 0 && p <= 1) {
+		panic("probabilistic: p outside [0, 1]")
+	}
+
+	return &probabilistic{
+		p: p,
+		r: newRand(rnd),
+	}
+}
+
+func (p *probabilistic) Admit(candidate, victim Pair) bool {
+	return p.r.Float64() < p.p
+}
+
+// NewSizeAdmitter constructs an Admitter which only admits candidates whose
+// size, as reported by size, is at most max.
+func NewSizeAdmitter(max int, size func(Pair) int) Admitter {
+	return AdmitterFunc(func(candidate, victim Pair) bool {
+		return size(candidate) <= max
+	})
+}
@@ -0,0 +1,51 @@
+package cache
+
+import "testing"
+
+func TestAdmission(t *testing.T) {
+	for _, c := range freshCaches(2) {
+		rejected := make(chan Pair, 1)
+		c.cache.Admission(AdmitterFunc(func(candidate, victim Pair) bool {
+			return candidate.Value != "reject"
+		}), rejected, false)
+
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+
+		if c.cache.Add(3, "reject") {
+			t.Fatalf("%s: add 3->reject", c.name)
+		}
+
+		if p := <-rejected; p.Key != 3 {
+			t.Fatalf("%s: rejected %v", c.name, p.Key)
+		}
+
+		if _, hit := c.cache.Get(3); hit {
+			t.Fatalf("%s: 3 admitted", c.name)
+		}
+
+		if l := c.cache.Len(); l != 2 {
+			t.Fatalf("%s: len %d", c.name, l)
+		}
+
+		c.cache.Add(3, 3)
+		if _, hit := c.cache.Get(3); !hit {
+			t.Fatalf("%s: 3 rejected", c.name)
+		}
+	}
+}
+
+func TestTinyLFU(t *testing.T) {
+	a := NewTinyLFU(16)
+	for i := 0; i < 4; i++ {
+		a.Record(1)
+	}
+
+	if a.Admit(Pair{Key: 2}, Pair{Key: 1}) {
+		t.Fatal("2 admitted over 1")
+	}
+
+	if !a.Admit(Pair{Key: 1}, Pair{Key: 3}) {
+		t.Fatal("1 rejected over 3")
+	}
+}
@@ -0,0 +1,90 @@
+package cache
+
+// Atomic represents a cache which can run a sequence of operations without
+// interleaving with other callers, such as a cache wrapped by NewLocked.
+type Atomic interface {
+	Cache
+
+	// Atomically calls f with the underlying cache, excluding all other
+	// operations until f returns. The function must not use the Atomic
+	// cache itself.
+	Atomically(f func(c Cache))
+}
+
+// Run f with c, atomically if c is an Atomic cache.
+func atomically(c Cache, f func(c Cache)) {
+	if a, ok := c.(Atomic); ok {
+		a.Atomically(f)
+	} else {
+		f(c)
+	}
+}
+
+// Compute replaces the value of key with the result of f, which is given the
+// old value and whether it existed. If keep is false, the key is deleted
+// instead. Returns the resulting value and whether the key exists, which is
+// false if the cache refused to add the value, such as when its admitter
+// rejected it. The operation is atomic if c is an Atomic cache, and f must not
+// use c.
+func Compute(c Cache, key interface{}, f func(old interface{}, ok bool) (value interface{}, keep bool)) (value interface{}, ok bool) {
+	atomically(c, func(c Cache) {
+		var old interface{}
+		var keep bool
+		old, ok = c.Get(key)
+		value, keep = f(old, ok)
+		switch {
+		case !keep:
+			_ = c.Delete(key)
+		case ok:
+			_ = c.Set(key, value)
+		default:
+			_ = c.Add(key, value)
+			keep = c.Contains(key)
+		}
+		if ok = keep; !ok {
+			value = nil
+		}
+	})
+	return
+}
+
+// GetOrAdd returns the existing value of key if it exists. Otherwise, it adds
+// and returns value. Returns whether the value was loaded rather than added.
+// If the cache refused to add the value, such as when its admitter rejected
+// it, actual is nil. The operation is atomic if c is an Atomic cache.
+func GetOrAdd(c Cache, key, value interface{}) (actual interface{}, loaded bool) {
+	atomically(c, func(c Cache) {
+		if actual, loaded = c.Get(key); !loaded {
+			_ = c.Add(key, value)
+			if c.Contains(key) {
+				actual = value
+			}
+		}
+	})
+	return
+}
+
+// CompareAndSwap sets the value of key to value if its existing value is equal
+// to old. Returns whether the value was swapped. The operation is atomic if c
+// is an Atomic cache. Values are compared with ==, which panics if they are not
+// comparable.
+func CompareAndSwap(c Cache, key, old, value interface{}) (swapped bool) {
+	atomically(c, func(c Cache) {
+		if v, ok := c.Get(key); ok && v == old {
+			swapped = c.Set(key, value)
+		}
+	})
+	return
+}
+
+// CompareAndDelete deletes key if its existing value is equal to old. Returns
+// whether the key was deleted. The operation is atomic if c is an Atomic cache.
+// Values are compared with ==, which panics if they are not comparable.
+func CompareAndDelete(c Cache, key, old interface{}) (deleted bool) {
+	atomically(c, func(c Cache) {
+		if v, ok := c.Get(key); ok && v == old {
+			deleted = c.Delete(key)
+		}
+	})
+	return
+}
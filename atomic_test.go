@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	c := NewLocked(NewLRU(16))
+	incr := func(old interface{}, ok bool) (interface{}, bool) {
+		if !ok {
+			return 1, true
+		}
+		return old.(int) + 1, true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Compute(c, "n", incr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, hit := c.Get("n"); !hit || value != 800 {
+		t.Fatalf("get n, got %v", value)
+	}
+
+	if value, ok := Compute(c, "n", incr); !ok || value != 801 {
+		t.Fatalf("compute n, got %v", value)
+	}
+
+	value, ok := Compute(c, "n", func(old interface{}, ok bool) (interface{}, bool) {
+		return nil, false
+	})
+	if ok || value != nil || c.Len() != 0 {
+		t.Fatal("compute delete")
+	}
+}
+
+func TestAtomicRejected(t *testing.T) {
+	c := NewLRU(1)
+	c.Admission(AdmitterFunc(func(candidate, victim Pair) bool {
+		return false
+	}), nil, false)
+	c.Add(1, 1)
+
+	value, ok := Compute(c, 2, func(old interface{}, ok bool) (interface{}, bool) {
+		return 2, true
+	})
+	if ok || value != nil || c.Contains(2) {
+		t.Fatalf("compute rejected, got %v %v", value, ok)
+	}
+
+	if actual, loaded := GetOrAdd(c, 3, 3); loaded || actual != nil || c.Contains(3) {
+		t.Fatalf("get or add rejected, got %v %v", actual, loaded)
+	}
+
+	if actual, loaded := GetOrAdd(c, 1, 5); !loaded || actual != 1 {
+		t.Fatalf("get or add 1, got %v %v", actual, loaded)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	for _, c := range freshCaches(2) {
+		if actual, loaded := GetOrAdd(c.cache, 1, "A"); loaded || actual != "A" {
+			t.Fatalf("%s: get or add 1->A", c.name)
+		}
+
+		if actual, loaded := GetOrAdd(c.cache, 1, "B"); !loaded || actual != "A" {
+			t.Fatalf("%s: get or add 1->B", c.name)
+		}
+
+		if CompareAndSwap(c.cache, 1, "B", "C") {
+			t.Fatalf("%s: swap B->C", c.name)
+		}
+
+		if !CompareAndSwap(c.cache, 1, "A", "C") {
+			t.Fatalf("%s: swap A->C", c.name)
+		}
+
+		if CompareAndDelete(c.cache, 1, "A") {
+			t.Fatalf("%s: delete A", c.name)
+		}
+
+		if !CompareAndDelete(c.cache, 1, "C") || c.cache.Len() != 0 {
+			t.Fatalf("%s: delete C", c.name)
+		}
+	}
+}
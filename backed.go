@@ -0,0 +1,420 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+// Store is a backing store of key-value pairs, such as a database.
+type Store interface {
+	// Load the value of key. Returns ErrNotFound if the key does not
+	// exist.
+	Load(key interface{}) (value interface{}, err error)
+
+	// Save the value of key.
+	Save(key, value interface{}) error
+
+	// Remove key. Removing a key which does not exist is not an error.
+	Remove(key interface{}) error
+}
+
+// WriteMode determines when writes to a backed cache reach its store.
+type WriteMode int
+
+const (
+	// WriteThrough writes to the store before each write to the cache
+	// returns.
+	WriteThrough WriteMode = iota
+
+	// WriteBack buffers writes, and flushes them to the store in the
+	// background.
+	WriteBack
+)
+
+// Backed represents a cache backed by a Store.
+type Backed interface {
+	Closer
+
+	// Flush writes all buffered writes to the store. Returns the first error
+	// from the store since the last Flush, including those of write-through
+	// and background writes.
+	Flush() error
+}
+
+type backed struct {
+	mu    sync.Mutex
+	cache Cache
+	store Store
+	mode  WriteMode
+
+	// Buffered writes not yet stored, which may have been evicted from
+	// the cache. Writes stay buffered while they are flushed, and until
+	// they are stored. Writes to the store are serialized by flushMu.
+	dirty   map[interface{}]*pending
+	flushMu sync.Mutex
+	err     error
+
+	// Loads in progress of keys missed by Get.
+	loads map[interface{}]*load
+
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	closed bool
+}
+
+// pending is a buffered write, either of a value or of a removal.
+type pending struct {
+	value  interface{}
+	remove bool
+}
+
+// load counts the loads in progress of a key, and the writes of the key since
+// the first of them started. A load which overlaps a write may be stale, so it
+// is not cached.
+type load struct {
+	n      int
+	writes uint64
+}
+
+// NewBacked wraps a cache, backing it with store. The returned cache is safe
+// for concurrent use. A Get miss loads the value from the store, without
+// holding the lock of the cache. Add, Set, and Delete are writes: a Set of a
+// key not in the cache adds it, and an Add which hits writes nothing.
+//
+// In WriteThrough mode, writes reach the store before the cache and before they
+// return, and a value which fails to save is removed from the cache. The lock
+// of the cache is not held while writing the store. In WriteBack mode, writes
+// are buffered, and dirty values are kept after being evicted until they are
+// flushed, so that no write is lost. Clear does not discard buffered writes.
+//
+// While the wrapper is unclosed, using the input cache is undefined behavior.
+// Closing the wrapper flushes all buffered writes, closes the input cache, and
+// returns the result of the final Flush.
+func NewBacked(cache Cache, store Store, mode WriteMode) Backed {
+	b := &backed{
+		cache: cache,
+		store: store,
+		mode:  mode,
+		dirty: make(map[interface{}]*pending),
+		loads: make(map[interface{}]*load),
+	}
+
+	if mode == WriteBack {
+		b.kick = make(chan struct{}, 1)
+		b.done = make(chan struct{})
+		b.stopped = make(chan struct{})
+		b.cache.OnEvict(b.evicted)
+		go b.flusher()
+	}
+	return b
+}
+
+func (b *backed) Get(key interface{}) (value interface{}, hit bool) {
+	b.mu.Lock()
+	if value, hit = b.cache.Get(key); hit || b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if w, ok := b.dirty[key]; ok {
+		defer b.mu.Unlock()
+		if w.remove {
+			return nil, false
+		}
+		_ = b.cache.Add(key, w.value)
+		return w.value, true
+	}
+	l := b.loads[key]
+	if l == nil {
+		l = &load{}
+		b.loads[key] = l
+	}
+	l.n++
+	writes := l.writes
+	b.mu.Unlock()
+
+	value, err := b.store.Load(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l.n--; l.n == 0 {
+		delete(b.loads, key)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			b.fail(err)
+		}
+		return nil, false
+	}
+
+	// The key may have been written while it was loading, in which case the
+	// loaded value is not cached.
+	if v, ok := b.cache.Get(key); ok {
+		return v, true
+	}
+	if w, ok := b.dirty[key]; ok {
+		return w.value, !w.remove
+	}
+	if !b.closed && l.writes == writes {
+		_ = b.cache.Add(key, value)
+	}
+	return value, true
+}
+
+func (b *backed) Add(key, value interface{}) (hit bool) {
+	if b.mode == WriteThrough {
+		return b.writeThrough(key, &pending{value: value}, true)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if hit = b.cache.Add(key, value); !hit && !b.closed {
+		b.buffer(key, &pending{value: value})
+	}
+	return
+}
+
+func (b *backed) Set(key, value interface{}) (hit bool) {
+	if b.mode == WriteThrough {
+		return b.writeThrough(key, &pending{value: value}, false)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if hit = b.cache.Set(key, value); !hit {
+		_ = b.cache.Add(key, value)
+	}
+	b.buffer(key, &pending{value: value})
+	return
+}
+
+func (b *backed) Delete(key interface{}) (hit bool) {
+	if b.mode == WriteThrough {
+		return b.writeThrough(key, &pending{remove: true}, false)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	hit = b.cache.Delete(key)
+	b.buffer(key, &pending{remove: true})
+	return
+}
+
+func (b *backed) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cache.Clear()
+}
+
+func (b *backed) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Len()
+}
+
+func (b *backed) Contains(key interface{}) (hit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Contains(key)
+}
+
+func (b *backed) Keys() []interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Keys()
+}
+
+func (b *backed) Cap() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Cap()
+}
+
+func (b *backed) Eviction(e chan<- Pair, block bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cache.Eviction(e, block)
+}
+
+func (b *backed) OnEvict(f func(EvictionEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cache.OnEvict(f)
+}
+
+func (b *backed) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cache.Admission(a, rejected, block)
+}
+
+func (b *backed) Pin(key interface{}) (hit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Pin(key)
+}
+
+func (b *backed) Unpin(key interface{}) (hit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Unpin(key)
+}
+
+func (b *backed) Dump() []Pair {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Dump()
+}
+
+func (b *backed) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	dirty := make(map[interface{}]*pending, len(b.dirty))
+	for key, w := range b.dirty {
+		dirty[key] = w
+	}
+	b.mu.Unlock()
+
+	for key, w := range dirty {
+		err := b.save(key, w)
+
+		// Drop the stored write, unless it was superseded. A failed
+		// write is kept for the next flush.
+		b.mu.Lock()
+		if err != nil {
+			b.fail(err)
+		} else if b.dirty[key] == w {
+			delete(b.dirty, key)
+		}
+		b.mu.Unlock()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.err
+	b.err = nil
+	return err
+}
+
+func (b *backed) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	if b.done != nil {
+		close(b.done)
+		<-b.stopped
+	}
+	err := b.Flush()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cerr := b.cache.Close(); err == nil {
+		err = cerr
+	}
+	b.cache = closedCache()
+	return err
+}
+
+// Buffer a write in WriteBack mode.
+func (b *backed) buffer(key interface{}, w *pending) {
+	b.dirty[key] = w
+	b.wrote(key)
+	b.flush()
+}
+
+// Write to the store and then the cache in WriteThrough mode, without holding
+// the lock of the cache while writing the store. If add, nothing is written if
+// key is in the cache.
+func (b *backed) writeThrough(key interface{}, w *pending, add bool) (hit bool) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	closed, hit := b.closed, b.cache.Contains(key)
+	b.mu.Unlock()
+	if closed || (add && hit) {
+		return hit && !closed
+	}
+
+	err := b.save(key, w)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.wrote(key)
+	if err != nil {
+		b.fail(err)
+	}
+	if w.remove || err != nil {
+		return b.cache.Delete(key)
+	}
+	if hit = b.cache.Set(key, w.value); !hit {
+		_ = b.cache.Add(key, w.value)
+	}
+	return
+}
+
+// Record a write of key for its loads in progress.
+func (b *backed) wrote(key interface{}) {
+	if l, ok := b.loads[key]; ok {
+		l.writes++
+	}
+}
+
+// Save or remove the value of key in the store.
+func (b *backed) save(key interface{}, w *pending) error {
+	if w.remove {
+		return b.store.Remove(key)
+	}
+	return b.store.Save(key, w.value)
+}
+
+// Record the first error since the last Flush.
+func (b *backed) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Flush buffered writes in the background, if a flush is not already pending.
+func (b *backed) flush() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (b *backed) flusher() {
+	defer close(b.stopped)
+	for {
+		select {
+		case <-b.kick:
+			// Errors are kept until the next call to Flush.
+			if err := b.Flush(); err != nil {
+				b.mu.Lock()
+				b.fail(err)
+				b.mu.Unlock()
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Flush the buffered write of an evicted value promptly, as it is now only
+// kept in the buffer.
+func (b *backed) evicted(event EvictionEvent) {
+	if _, ok := b.dirty[event.Key]; ok {
+		b.flush()
+	}
+}
@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapStore struct {
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+	err    error
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{values: make(map[interface{}]interface{})}
+}
+
+func (s *mapStore) Load(key interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *mapStore) Save(key, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *mapStore) Remove(key interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.values, key)
+	return nil
+}
+
+func (s *mapStore) value(key interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// slowStore blocks each Save until released, after announcing the first
+// waiting Save.
+type slowStore struct {
+	*mapStore
+	saving  chan interface{}
+	release chan struct{}
+}
+
+func newSlowStore() *slowStore {
+	return &slowStore{
+		mapStore: newMapStore(),
+		saving:   make(chan interface{}, 1),
+		release:  make(chan struct{}),
+	}
+}
+
+func (s *slowStore) Save(key, value interface{}) error {
+	select {
+	case s.saving <- key:
+	default:
+	}
+	<-s.release
+	return s.mapStore.Save(key, value)
+}
+
+// slowLoadStore blocks each Load after reading the value, until released.
+type slowLoadStore struct {
+	*mapStore
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (s *slowLoadStore) Load(key interface{}) (interface{}, error) {
+	value, err := s.mapStore.Load(key)
+	s.loading <- struct{}{}
+	<-s.release
+	return value, err
+}
+
+func TestBackedWriteThrough(t *testing.T) {
+	s := newMapStore()
+	s.values[1] = 1
+	b := NewBacked(NewLRU(2), s, WriteThrough)
+	defer b.Close()
+
+	if v, hit := b.Get(1); !hit || v != 1 || !b.Contains(1) {
+		t.Fatalf("get %v %v", v, hit)
+	}
+
+	b.Set(2, 2)
+	b.Delete(1)
+	if s.value(2) != 2 || s.value(1) != nil {
+		t.Fatalf("store %v", s.values)
+	}
+
+	errSave := errors.New("save failed")
+	s.err = errSave
+	b.Set(3, 3)
+	if b.Contains(3) {
+		t.Fatal("unsaved value cached")
+	}
+	if err := b.Flush(); err != errSave {
+		t.Fatalf("flush %v", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("flush %v", err)
+	}
+}
+
+func TestBackedWriteBack(t *testing.T) {
+	s := newMapStore()
+	s.values[3] = 3
+	b := NewBacked(NewLRU(1), s, WriteBack)
+
+	evicted := make(chan Pair, 4)
+	b.Eviction(evicted, true)
+
+	// 1 is evicted, but its write is not lost.
+	b.Set(1, 1)
+	b.Set(2, 2)
+	b.Delete(3)
+	if len(evicted) != 1 {
+		t.Fatalf("evicted %d", len(evicted))
+	}
+	if v, hit := b.Get(1); !hit || v != 1 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+	if _, hit := b.Get(3); hit {
+		t.Fatal("get deleted hit")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s.value(1) != 1 || s.value(2) != 2 || s.value(3) != nil {
+		t.Fatalf("store %v", s.values)
+	}
+}
+
+func TestBackedWriteThroughSlow(t *testing.T) {
+	s := newSlowStore()
+	s.values[1] = 1
+	b := NewBacked(NewLRU(2), s, WriteThrough)
+	defer b.Close()
+	b.Get(1)
+
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		b.Set(2, 2)
+	}()
+	<-s.saving
+
+	// The cache is not locked while the store is written.
+	got := make(chan interface{})
+	go func() {
+		v, _ := b.Get(1)
+		got <- v
+	}()
+	select {
+	case v := <-got:
+		if v != 1 {
+			t.Fatalf("get %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("get blocked by save")
+	}
+
+	close(s.release)
+	<-saved
+	if v, hit := b.Get(2); !hit || v != 2 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+}
+
+func TestBackedWriteBackSlow(t *testing.T) {
+	s := newSlowStore()
+	b := NewBacked(NewLRU(1), s, WriteBack)
+
+	// 1 is evicted while it is being flushed, and is still served.
+	b.Set(1, "new")
+	if key := <-s.saving; key != 1 {
+		t.Fatalf("saving %v", key)
+	}
+	b.Set(2, 2)
+	if v, hit := b.Get(1); !hit || v != "new" {
+		t.Fatalf("get %v %v", v, hit)
+	}
+
+	close(s.release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s.value(1) != "new" || s.value(2) != 2 {
+		t.Fatalf("store %v", s.values)
+	}
+}
+
+func TestBackedLoadWritten(t *testing.T) {
+	for _, mode := range []WriteMode{WriteThrough, WriteBack} {
+		s := &slowLoadStore{
+			mapStore: newMapStore(),
+			loading:  make(chan struct{}),
+			release:  make(chan struct{}),
+		}
+		s.values[1] = 1
+		b := NewBacked(NewLRU(2), s, mode)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			b.Get(1)
+		}()
+		<-s.loading
+
+		// The value deleted while it was loading is not cached again.
+		b.Delete(1)
+		if err := b.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		close(s.release)
+		<-done
+		if b.Contains(1) {
+			t.Fatalf("mode %d: deleted value cached", mode)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+// manyGetter is implemented by caches which can get many keys more efficiently
+// than one at a time.
+type manyGetter interface {
+	getMany(keys []interface{}) (values []interface{}, hits []bool)
+}
+
+// GetMany gets the values of many keys. Results are given in the same order as
+// the keys. If c is an Atomic cache, the keys are read in a single atomic
+// operation.
+func GetMany(c Cache, keys []interface{}) (values []interface{}, hits []bool) {
+	atomically(c, func(c Cache) {
+		if m, ok := c.(manyGetter); ok {
+			values, hits = m.getMany(keys)
+			return
+		}
+
+		values = make([]interface{}, len(keys))
+		hits = make([]bool, len(keys))
+		for i, key := range keys {
+			values[i], hits[i] = c.Get(key)
+		}
+	})
+	return
+}
+
+// AddMany adds many pairs to the cache, in order. Returns whether each add hit.
+// If c is an Atomic cache, the pairs are added in a single atomic operation.
+func AddMany(c Cache, pairs []Pair) (hits []bool) {
+	hits = make([]bool, len(pairs))
+	atomically(c, func(c Cache) {
+		for i, p := range pairs {
+			hits[i] = c.Add(p.Key, p.Value)
+		}
+	})
+	return
+}
+
+// SetMany sets many pairs in the cache, in order. Returns whether each set hit.
+// If c is an Atomic cache, the pairs are set in a single atomic operation.
+func SetMany(c Cache, pairs []Pair) (hits []bool) {
+	hits = make([]bool, len(pairs))
+	atomically(c, func(c Cache) {
+		for i, p := range pairs {
+			hits[i] = c.Set(p.Key, p.Value)
+		}
+	})
+	return
+}
+
+// DeleteMany deletes many keys from the cache. Returns whether each delete hit.
+// If c is an Atomic cache, the keys are deleted in a single atomic operation.
+func DeleteMany(c Cache, keys []interface{}) (hits []bool) {
+	hits = make([]bool, len(keys))
+	atomically(c, func(c Cache) {
+		for i, key := range keys {
+			hits[i] = c.Delete(key)
+		}
+	})
+	return
+}
@@ -0,0 +1,99 @@
+package cache
+
+import "testing"
+
+func TestBatch(t *testing.T) {
+	c := NewLocked(NewLRU(4))
+
+	hits := AddMany(c, []Pair{{1, "A"}, {2, "B"}, {1, "C"}})
+	if hits[0] || hits[1] || !hits[2] {
+		t.Fatalf("add many %v", hits)
+	}
+
+	hits = SetMany(c, []Pair{{1, "D"}, {3, "E"}})
+	if !hits[0] || hits[1] {
+		t.Fatalf("set many %v", hits)
+	}
+
+	values, hits := GetMany(c, []interface{}{1, 2, 3})
+	if values[0] != "D" || values[1] != "B" || !hits[0] || !hits[1] || hits[2] {
+		t.Fatalf("get many %v %v", values, hits)
+	}
+
+	hits = DeleteMany(c, []interface{}{2, 3})
+	if !hits[0] || hits[1] || c.Len() != 1 {
+		t.Fatalf("delete many %v", hits)
+	}
+}
+
+func TestSegmentedGetMany(t *testing.T) {
+	evicted := make(chan Pair, 8)
+	s := NewSegmented(NewFIFO(3), NewLRU(2))
+	defer s.Close()
+	s.Eviction(evicted, true)
+
+	for i := 0; i < 3; i++ {
+		s.Add(i, i)
+	}
+	GetMany(s, []interface{}{0, 1})
+
+	for i := 3; i < 5; i++ {
+		s.Add(i, i)
+	}
+
+	// Promoting 2, 3, and 4 demotes 0 and 1, then 2 is demoted in turn.
+	values, hits := GetMany(s, []interface{}{2, 3, 4, 2, 5})
+	for i, v := range []interface{}{2, 3, 4, 2, nil} {
+		if values[i] != v || hits[i] != (v != nil) {
+			t.Fatalf("get many %v %v", values, hits)
+		}
+	}
+
+	seen := make(map[interface{}]bool)
+	for _, p := range s.Dump() {
+		if seen[p.Key] {
+			t.Fatalf("duplicate %v", p.Key)
+		}
+		seen[p.Key] = true
+	}
+
+	if l := s.Len() + len(evicted); l != 5 {
+		t.Fatalf("len %d", l)
+	}
+
+	// Promoting A evicts X before X is promoted, so X is only demoted.
+	s = NewSegmented(NewFIFO(4), NewFIFO(1), NewFIFO(1))
+	defer s.Close()
+	s.Add("X", 1)
+	s.Get("X")
+	s.Add("A", 2)
+	GetMany(s, []interface{}{"A", "X"})
+
+	seen = make(map[interface{}]bool)
+	for _, p := range s.Dump() {
+		if seen[p.Key] {
+			t.Fatalf("duplicate %v", p.Key)
+		}
+		seen[p.Key] = true
+	}
+	if tiers := s.Tiers(); tiers[0].Len != 1 || tiers[1].Len != 1 || tiers[2].Len != 0 {
+		t.Fatalf("tiers %+v", tiers)
+	}
+}
+
+func TestSegmentedGetManyRejected(t *testing.T) {
+	s := NewSegmented(NewFIFO(2), NewLRU(1))
+	defer s.Close()
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Get(1)
+	s.Pin(1)
+
+	// The higher cache is full of pinned items, so 2 stays where it is,
+	// and is not counted as promoted.
+	GetMany(s, []interface{}{2})
+	if tiers := s.Tiers(); tiers[0].Len != 1 || tiers[0].Promotions != 1 {
+		t.Fatalf("tiers %+v", tiers)
+	}
+}
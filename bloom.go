@@ -0,0 +1,49 @@
+package cache
+
+import "math"
+
+// bloom is a Bloom filter over cache keys.
+type bloom struct {
+	bits   []uint64
+	m      uint64
+	hashes int
+}
+
+// Construct a Bloom filter sized for n keys with a false positive rate of p.
+func newBloom(n int, p float64) *bloom {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	if m < 64 {
+		m = 64
+	}
+	hashes := int(math.Round(m / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	return &bloom{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		m:      uint64(m),
+		hashes: hashes,
+	}
+}
+
+// Add key to the filter. Returns whether the key may have already existed.
+func (b *bloom) add(key interface{}) (exists bool) {
+	exists = true
+	h := hashKey(key)
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := 0; i < b.hashes; i++ {
+		n := (h1 + uint64(i)*h2) % b.m
+		if b.bits[n/64]&(1<<(n%64)) == 0 {
+			exists = false
+			b.bits[n/64] |= 1 << (n % 64)
+		}
+	}
+	return
+}
+
+func (b *bloom) reset() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+}
@@ -0,0 +1,547 @@
+package cache
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	readBufferSize  = 16
+	writeBufferSize = 128
+)
+
+// Buffered represents a concurrent cache which records accesses in buffers,
+// and replays them to the cache it wraps in batches.
+type Buffered interface {
+	Cache
+
+	// Cleanup replays all buffered accesses and writes to the wrapped
+	// cache, so that its state is up to date.
+	Cleanup()
+}
+
+type buffered struct {
+	mu    sync.Mutex
+	cache Cache
+
+	// The entry of each key, which is read and written without the lock of
+	// the cache.
+	dataMu sync.RWMutex
+	data   map[interface{}]*bufEntry
+
+	reads    []readBuffer
+	writes   chan write
+	draining int32
+
+	// The entry of each key in the cache, as of the writes replayed so far,
+	// which is kept under the lock.
+	applied map[interface{}]*bufEntry
+
+	rejections chan Pair
+	rejected   chan<- Pair
+	rblock     bool
+
+	e         chan<- Pair
+	block     bool
+	listeners []func(EvictionEvent)
+
+	closed int32
+}
+
+// bufEntry is the value stored in the wrapped cache for each key, so that an
+// evicted entry can be told apart from a newer entry of the same key.
+type bufEntry struct {
+	value atomic.Value
+}
+
+type boxed struct {
+	v interface{}
+}
+
+func newBufEntry(value interface{}) *bufEntry {
+	e := &bufEntry{}
+	e.store(value)
+	return e
+}
+
+func (e *bufEntry) load() interface{} {
+	return e.value.Load().(boxed).v
+}
+
+func (e *bufEntry) store(value interface{}) {
+	e.value.Store(boxed{value})
+}
+
+// readBuffer is a lossy buffer of keys which were hit. Keys recorded while the
+// buffer is full are dropped.
+type readBuffer struct {
+	mu   sync.Mutex
+	keys []interface{}
+}
+
+type writeOp int
+
+const (
+	writeAdd writeOp = iota
+	writeSet
+	writeDelete
+)
+
+type write struct {
+	op    writeOp
+	key   interface{}
+	entry *bufEntry
+}
+
+// NewBuffered wraps a cache for concurrent use, like NewLocked, except that
+// hits are served without locking the cache. Hits are instead recorded into
+// striped, lossy read buffers, and writes into a bounded write buffer, which
+// are replayed to the cache in batches under a single lock acquisition, in the
+// manner of the Caffeine library. This suits caches such as LRU and LFU, whose
+// Get modifies the cache. Hits dropped by a full read buffer are never
+// replayed, so the wrapped cache sees an approximation of the accesses.
+//
+// The eviction listeners and admission policy of the input cache will be
+// replaced. While the wrapper is unclosed, using the input cache is undefined
+// behavior. Closing the wrapper closes the input cache. The returned cache is
+// Atomic, and its atomic operations replay all buffers first.
+func NewBuffered(cache Cache) Buffered {
+	b := &buffered{
+		cache:      cache,
+		data:       make(map[interface{}]*bufEntry),
+		reads:      make([]readBuffer, 4*runtime.GOMAXPROCS(0)),
+		writes:     make(chan write, writeBufferSize),
+		applied:    make(map[interface{}]*bufEntry),
+		rejections: make(chan Pair, 1),
+	}
+
+	for i := range b.reads {
+		b.reads[i].keys = make([]interface{}, 0, readBufferSize)
+	}
+
+	b.cache.Eviction(nil, false)
+	b.cache.OnEvict(b.evicted)
+	b.cache.Admission(nil, b.rejections, true)
+	return b
+}
+
+func (b *buffered) Get(key interface{}) (value interface{}, hit bool) {
+	var entry *bufEntry
+	if entry, hit = b.load(key); hit {
+		value = entry.load()
+		b.record(key)
+	}
+	return
+}
+
+func (b *buffered) Add(key, value interface{}) (hit bool) {
+	entry := newBufEntry(value)
+	var stored bool
+	if hit, stored = b.loadOrStore(key, entry); stored {
+		b.write(write{writeAdd, key, entry})
+	}
+	return
+}
+
+func (b *buffered) Set(key, value interface{}) (hit bool) {
+	var entry *bufEntry
+	if entry, hit = b.load(key); hit {
+		entry.store(value)
+		b.write(write{writeSet, key, entry})
+	}
+	return
+}
+
+func (b *buffered) Delete(key interface{}) (hit bool) {
+	var entry *bufEntry
+	if entry, hit = b.loadAndDelete(key); hit {
+		b.write(write{writeDelete, key, entry})
+	}
+	return
+}
+
+func (b *buffered) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	b.clear()
+}
+
+func (b *buffered) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	return b.cache.Len()
+}
+
+func (b *buffered) Contains(key interface{}) (hit bool) {
+	_, hit = b.load(key)
+	return
+}
+
+func (b *buffered) Keys() []interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	return b.cache.Keys()
+}
+
+func (b *buffered) Cap() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cache.Cap()
+}
+
+func (b *buffered) Eviction(e chan<- Pair, block bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.e, b.block = e, block
+}
+
+func (b *buffered) OnEvict(f func(EvictionEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, f)
+}
+
+func (b *buffered) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.admission(a, rejected, block)
+}
+
+func (b *buffered) Pin(key interface{}) (hit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	return b.cache.Pin(key)
+}
+
+func (b *buffered) Unpin(key interface{}) (hit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	return b.cache.Unpin(key)
+}
+
+func (b *buffered) Dump() []Pair {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	return b.dump()
+}
+
+func (b *buffered) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	return b.close()
+}
+
+func (b *buffered) Cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+}
+
+// Atomically calls f with a view of the buffered cache, which applies each
+// operation to the wrapped cache immediately.
+func (b *buffered) Atomically(f func(c Cache)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drain()
+	f(bufferedView{b})
+}
+
+func (b *buffered) clear() {
+	b.cache.Clear()
+	b.clearData()
+	b.applied = make(map[interface{}]*bufEntry)
+}
+
+func (b *buffered) admission(a Admitter, rejected chan<- Pair, block bool) {
+	b.rejected, b.rblock = rejected, block
+	if a == nil {
+		b.cache.Admission(nil, b.rejections, true)
+		return
+	}
+	b.cache.Admission(AdmitterFunc(func(candidate, victim Pair) bool {
+		return a.Admit(unbuffered(candidate), unbuffered(victim))
+	}), b.rejections, true)
+}
+
+func (b *buffered) dump() []Pair {
+	pairs := b.cache.Dump()
+	for i := range pairs {
+		pairs[i] = unbuffered(pairs[i])
+	}
+	return pairs
+}
+
+func (b *buffered) close() error {
+	if !atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		return ErrClosed
+	}
+	b.clearData()
+	b.applied = make(map[interface{}]*bufEntry)
+	b.e, b.listeners, b.rejected = nil, nil, nil
+	err := b.cache.Close()
+	b.cache = closedCache()
+	return err
+}
+
+// Record a hit of key in its read buffer, replaying the buffers if it is full
+// and another replay is not already pending.
+func (b *buffered) record(key interface{}) {
+	r := &b.reads[hashKey(key)%uint64(len(b.reads))]
+	r.mu.Lock()
+	full := len(r.keys) == cap(r.keys)
+	if !full {
+		r.keys = append(r.keys, key)
+	}
+	r.mu.Unlock()
+
+	if full {
+		b.tryDrain()
+	}
+}
+
+// Buffer a write, replaying the buffers if another replay is not already
+// pending. If the write buffer is full, wait for the lock to replay it.
+func (b *buffered) write(w write) {
+	select {
+	case b.writes <- w:
+		b.tryDrain()
+	default:
+		b.mu.Lock()
+		b.drain()
+		b.apply(w)
+		b.mu.Unlock()
+	}
+}
+
+// Replay the buffers, unless another goroutine is already waiting for the lock
+// to replay them. At most one goroutine waits, so the others do not contend for
+// the lock.
+func (b *buffered) tryDrain() {
+	if !atomic.CompareAndSwapInt32(&b.draining, 0, 1) {
+		return
+	}
+	b.mu.Lock()
+	atomic.StoreInt32(&b.draining, 0)
+	b.drain()
+	b.mu.Unlock()
+}
+
+// Replay all buffered hits, then all buffered writes, to the cache. The lock
+// must be held.
+func (b *buffered) drain() {
+	for i := range b.reads {
+		r := &b.reads[i]
+		r.mu.Lock()
+		keys := r.keys
+		r.keys = make([]interface{}, 0, readBufferSize)
+		r.mu.Unlock()
+
+		for _, key := range keys {
+			_, _ = b.cache.Get(key)
+		}
+	}
+
+writes:
+	for {
+		select {
+		case w := <-b.writes:
+			b.apply(w)
+		default:
+			break writes
+		}
+	}
+}
+
+// Apply a buffered write to the cache, unless a later write to the same key
+// superseded it. The lock must be held.
+func (b *buffered) apply(w write) {
+	switch w.op {
+	case writeAdd:
+		if entry, ok := b.load(w.key); !ok || entry != w.entry {
+			return
+		}
+		if b.cache.Add(w.key, w.entry) {
+			_ = b.cache.Set(w.key, w.entry)
+		}
+		select {
+		case p := <-b.rejections:
+			b.compareAndDelete(p.Key, p.Value)
+			send(b.rejected, b.rblock, unbuffered(p))
+		default:
+			b.applied[w.key] = w.entry
+		}
+	case writeSet:
+		if entry, ok := b.load(w.key); ok && entry == w.entry {
+			_ = b.cache.Set(w.key, w.entry)
+		}
+	case writeDelete:
+		// The cache is not checked with Get, which would count as an
+		// access of the key.
+		if b.applied[w.key] == w.entry {
+			delete(b.applied, w.key)
+			_ = b.cache.Delete(w.key)
+		}
+	}
+}
+
+// Listener for evictions from the cache, which is called with the lock held.
+func (b *buffered) evicted(event EvictionEvent) {
+	if entry, ok := b.applied[event.Key]; ok && entry == event.Value {
+		delete(b.applied, event.Key)
+	}
+	b.compareAndDelete(event.Key, event.Value)
+	p := unbuffered(event.Pair)
+	send(b.e, b.block, p)
+	notify(b.listeners, p)
+}
+
+func (b *buffered) load(key interface{}) (entry *bufEntry, ok bool) {
+	b.dataMu.RLock()
+	defer b.dataMu.RUnlock()
+	entry, ok = b.data[key]
+	return
+}
+
+// Store the entry of key, unless it already has one or the cache is closed.
+// Close clears the entries after marking the cache closed, so no entry is
+// stored once they are cleared.
+func (b *buffered) loadOrStore(key interface{}, entry *bufEntry) (loaded, stored bool) {
+	b.dataMu.Lock()
+	defer b.dataMu.Unlock()
+	if _, loaded = b.data[key]; loaded || atomic.LoadInt32(&b.closed) != 0 {
+		return
+	}
+	b.data[key] = entry
+	return false, true
+}
+
+func (b *buffered) loadAndDelete(key interface{}) (entry *bufEntry, ok bool) {
+	b.dataMu.Lock()
+	defer b.dataMu.Unlock()
+	if entry, ok = b.data[key]; ok {
+		delete(b.data, key)
+	}
+	return
+}
+
+// Delete the entry of key if it is still entry.
+func (b *buffered) compareAndDelete(key, entry interface{}) {
+	b.dataMu.Lock()
+	defer b.dataMu.Unlock()
+	if e, ok := b.data[key]; ok && e == entry {
+		delete(b.data, key)
+	}
+}
+
+func (b *buffered) clearData() {
+	b.dataMu.Lock()
+	defer b.dataMu.Unlock()
+	b.data = make(map[interface{}]*bufEntry)
+}
+
+// Replace the entry of a pair from the cache with its value.
+func unbuffered(p Pair) Pair {
+	if entry, ok := p.Value.(*bufEntry); ok {
+		p.Value = entry.load()
+	}
+	return p
+}
+
+// bufferedView is the cache given to Atomically, which is used with the lock
+// held and the buffers replayed. Its writes are applied to the wrapped cache
+// immediately rather than buffered, and its values are unwrapped from their
+// entries.
+type bufferedView struct {
+	b *buffered
+}
+
+func (v bufferedView) Get(key interface{}) (value interface{}, hit bool) {
+	var entry *bufEntry
+	if entry, hit = v.b.load(key); hit {
+		value = entry.load()
+		_, _ = v.b.cache.Get(key)
+	}
+	return
+}
+
+func (v bufferedView) Add(key, value interface{}) (hit bool) {
+	entry := newBufEntry(value)
+	var stored bool
+	if hit, stored = v.b.loadOrStore(key, entry); stored {
+		v.b.apply(write{writeAdd, key, entry})
+	}
+	return
+}
+
+func (v bufferedView) Set(key, value interface{}) (hit bool) {
+	var entry *bufEntry
+	if entry, hit = v.b.load(key); hit {
+		entry.store(value)
+		v.b.apply(write{writeSet, key, entry})
+	}
+	return
+}
+
+func (v bufferedView) Delete(key interface{}) (hit bool) {
+	var entry *bufEntry
+	if entry, hit = v.b.loadAndDelete(key); hit {
+		v.b.apply(write{writeDelete, key, entry})
+	}
+	return
+}
+
+func (v bufferedView) Clear() {
+	v.b.clear()
+}
+
+func (v bufferedView) Len() int {
+	return v.b.cache.Len()
+}
+
+func (v bufferedView) Contains(key interface{}) (hit bool) {
+	return v.b.Contains(key)
+}
+
+func (v bufferedView) Keys() []interface{} {
+	return v.b.cache.Keys()
+}
+
+func (v bufferedView) Cap() int {
+	return v.b.cache.Cap()
+}
+
+func (v bufferedView) Eviction(e chan<- Pair, block bool) {
+	v.b.e, v.b.block = e, block
+}
+
+func (v bufferedView) OnEvict(f func(EvictionEvent)) {
+	v.b.listeners = append(v.b.listeners, f)
+}
+
+func (v bufferedView) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	v.b.admission(a, rejected, block)
+}
+
+func (v bufferedView) Pin(key interface{}) (hit bool) {
+	return v.b.cache.Pin(key)
+}
+
+func (v bufferedView) Unpin(key interface{}) (hit bool) {
+	return v.b.cache.Unpin(key)
+}
+
+func (v bufferedView) Dump() []Pair {
+	return v.b.dump()
+}
+
+func (v bufferedView) Close() error {
+	return v.b.close()
+}
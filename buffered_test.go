@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBuffered(t *testing.T) {
+	evicted := make(chan Pair, 1)
+	b := NewBuffered(NewLRU(2))
+	defer b.Close()
+	b.Eviction(evicted, false)
+
+	b.Add(1, "A")
+	b.Add(2, "B")
+
+	if value, hit := b.Get(1); !hit || value != "A" {
+		t.Fatalf("get 1, got %v", value)
+	}
+
+	// The hit of 1 is replayed before 3 is added, so 2 is evicted.
+	b.Add(3, "C")
+	b.Cleanup()
+
+	if p := <-evicted; p.Key != 2 || p.Value != "B" {
+		t.Fatalf("evicted %v", p)
+	}
+
+	if b.Contains(2) {
+		t.Fatal("2 not evicted")
+	}
+
+	b.Set(1, "D")
+	if value, _ := b.Get(1); value != "D" {
+		t.Fatalf("get 1, got %v", value)
+	}
+
+	if !b.Delete(1) || b.Len() != 1 {
+		t.Fatal("delete 1")
+	}
+}
+
+func TestBufferedDelete(t *testing.T) {
+	s := NewSegmented(NewFIFO(2), NewLRU(1))
+	b := NewBuffered(s)
+	defer b.Close()
+
+	b.Add(1, 1)
+	b.Add(2, 2)
+	b.Get(1)
+	b.Cleanup()
+
+	// Deleting 2 is not an access of it, which would promote it and demote
+	// 1.
+	b.Delete(2)
+	b.Cleanup()
+	if tiers := s.Tiers(); tiers[1].Len != 1 || tiers[1].Demotions != 0 {
+		t.Fatalf("tiers %+v", tiers)
+	}
+}
+
+func TestBufferedAtomic(t *testing.T) {
+	b := NewBuffered(NewLRU(4))
+	defer b.Close()
+
+	b.Add(1, "A")
+	values, hits := GetMany(b, []interface{}{1, 2})
+	if !hits[0] || values[0] != "A" || hits[1] {
+		t.Fatalf("get many %v %v", values, hits)
+	}
+
+	Compute(b, 1, func(old interface{}, ok bool) (interface{}, bool) {
+		if !ok || old != "A" {
+			t.Fatalf("old %v %v", old, ok)
+		}
+		return "B", true
+	})
+	if value, _ := b.Get(1); value != "B" {
+		t.Fatalf("get 1, got %v", value)
+	}
+
+	Compute(b, 2, func(interface{}, bool) (interface{}, bool) {
+		return "C", true
+	})
+	if value, hit := b.Get(2); !hit || value != "C" || !b.Contains(2) || b.Len() != 2 {
+		t.Fatalf("get 2, got %v %v", value, hit)
+	}
+}
+
+func TestBufferedConcurrent(t *testing.T) {
+	b := NewBuffered(NewLFU(64))
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := (i * j) % 128
+				if _, hit := b.Get(key); !hit {
+					b.Add(key, key)
+				}
+				if j%10 == 0 {
+					b.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	b.Cleanup()
+
+	keys := b.Keys()
+	if len(keys) > 64 {
+		t.Fatalf("len %d", len(keys))
+	}
+
+	for _, key := range keys {
+		if value, hit := b.Get(key); !hit || value != key {
+			t.Fatalf("get %v, got %v", key, value)
+		}
+	}
+}
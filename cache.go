@@ -3,32 +3,53 @@
 // Cache replacement algorithms currently implemented:
 //
 //	FIFO: first-in first-out
+//	FIFO-Reinsertion: first-in first-out with a second chance
 //	LFU: least-frequently used
 //	LIFO: last-in first-out
+//	LRFU: least-recently/frequently used
 //	LRU: least-recently used
 //	MRU: most-recently used
+//	OPT: Belady's optimal (offline)
+//	RandomK: least-recently used of k random samples
 //	RR: random-replacement
 //
-// They all operate in constant time, with the exception of the Dump function
-// which has a runtime of O(n) where n is the size of the cache.
+// They all operate in constant time, with the exception of LRFU and OPT, which
+// operate in logarithmic time, RandomK, which evicts in O(k) time, and the Dump
+// function which has a runtime of O(n) where n is the size of the cache.
 package cache
 
-import "io"
+import (
+	"errors"
+	"io"
+)
+
+// ErrClosed is returned when closing a cache which is already closed.
+var ErrClosed = errors.New("cache: closed")
 
 // Cache represents a cache implementation. Unless specified otherwise, all
 // caches will panic if constructed with a capacity <= 0.
+//
+// Closing a cache releases it and invalidates future operations, which then
+// act as on an empty cache with no capacity: Get misses, Add adds nothing, and
+// Len and Cap return 0. Closing a closed cache returns ErrClosed.
 type Cache interface {
+	io.Closer
+
 	// Get value in the cache.
 	Get(key interface{}) (value interface{}, hit bool)
 
 	// Add value to the cache. If the value already exists, nothing is
-	// changed.
+	// changed. If the cache is full and every item is pinned, the value is
+	// not added and is sent through the admission rejection channel. Add
+	// returns false in that case, as it does when the value is added, so use
+	// Contains or the rejection channel to tell the two apart.
 	Add(key, value interface{}) (hit bool)
 
 	// Set value in the cache. This serves as an optimization of Delete+Add.
 	Set(key, value interface{}) (hit bool)
 
-	// Delete value from the cache. Returns whether the delete hit.
+	// Delete value from the cache. Returns whether the delete hit. Deleted
+	// values are no longer pinned.
 	Delete(key interface{}) (hit bool)
 
 	// Clear all values in the cache. Clearing does not invalidate future
@@ -38,27 +59,175 @@ type Cache interface {
 	// Len returns the number of items in the cache.
 	Len() int
 
+	// Contains returns whether key is in the cache. Unlike Get, it is not
+	// considered an access of the key.
+	Contains(key interface{}) (hit bool)
+
+	// Keys returns the keys in the cache in no particular order.
+	Keys() []interface{}
+
+	// Cap returns the capacity of the cache.
+	Cap() int
+
 	// Eviction registers a channel through which evicted key-value pairs
 	// will be sent. Only pairs automatically evicted will be sent, not
-	// those manually removed with Delete.
+	// those manually removed with Delete. If block is true, a send blocks
+	// the operation which caused the eviction until the pair is received.
+	// Use a Delivery to bound how long a send may block.
 	Eviction(e chan<- Pair, block bool)
 
+	// OnEvict registers a listener which will be called with each evicted
+	// key-value pair, alongside the eviction channel. Listeners are called
+	// synchronously in the order they were registered, and must not use
+	// the cache. Use a Dispatcher to call listeners asynchronously.
+	OnEvict(f func(EvictionEvent))
+
+	// Admission registers an admitter consulted before an item is evicted
+	// to make room for a new key, and a channel through which rejected
+	// key-value pairs will be sent. A nil admitter admits all keys.
+	Admission(a Admitter, rejected chan<- Pair, block bool)
+
+	// Pin value in the cache, preventing it from being evicted until it is
+	// unpinned as many times as it was pinned. Returns whether the pin hit.
+	Pin(key interface{}) (hit bool)
+
+	// Unpin value in the cache. Returns whether the value was pinned.
+	Unpin(key interface{}) (hit bool)
+
 	// Dump the contents of the cache in no particular order.
 	Dump() []Pair
 }
 
+// Previewer represents a cache which can tell which item would be evicted by
+// the next Add to a full cache. The FIFO, LFU, LIFO, LRFU, LRU, MRU, OPT, and
+// RR caches are Previewers, and caches wrapped by NewLocked or NewRWLocked are
+// Previewers only if the caches they wrap are.
+type Previewer interface {
+	// NextVictim returns the next item to be evicted. Returns false if the
+	// cache is empty or every item is pinned.
+	NextVictim() (victim Pair, ok bool)
+}
+
+// Resizer represents a cache whose capacity can change. Every cache constructed
+// by this package, other than wrappers, is a Resizer. Caches wrapped by
+// NewLocked or NewRWLocked are Resizers only if the caches they wrap are.
+type Resizer interface {
+	// Resize sets the capacity of the cache, evicting items as a full
+	// cache would until they fit. If too many items are pinned, the cache
+	// stays over capacity until they are removed. Panics if capacity <= 0.
+	Resize(capacity int)
+}
+
 // Pair represents the key-value pair in a cache.
 type Pair struct {
 	Key, Value interface{}
 }
 
-// Closer represents a cache should be closed when they will no longer be used.
-// Unlike clearing a cache, closing a cache invalidates future operations.
+// Closer represents a cache which should be closed when it will no longer be
+// used. Every Cache is now a Closer, and this type remains for compatibility.
+// Closing a wrapper, such as one constructed by NewLocked or NewSegmented, also
+// closes the caches it wraps.
 type Closer interface {
 	Cache
 	io.Closer
 }
 
+// hooks holds the eviction channel and listeners, admission policy, and pinned
+// keys of a cache.
+type hooks struct {
+	e         chan<- Pair
+	block     bool
+	listeners []func(EvictionEvent)
+
+	admitter Admitter
+	rejected chan<- Pair
+	rblock   bool
+
+	pins map[interface{}]int
+
+	closed bool
+}
+
+func (h *hooks) Eviction(e chan<- Pair, block bool) {
+	h.e, h.block = e, block
+}
+
+func (h *hooks) OnEvict(f func(EvictionEvent)) {
+	h.listeners = append(h.listeners, f)
+}
+
+func (h *hooks) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	h.admitter, h.rejected, h.rblock = a, rejected, block
+}
+
+func (h *hooks) evict(p Pair) {
+	send(h.e, h.block, p)
+	notify(h.listeners, p)
+}
+
+// Return whether candidate should replace victim, sending rejected candidates
+// through the rejection channel.
+func (h *hooks) admit(candidate, victim Pair) bool {
+	if h.admitter == nil || h.admitter.Admit(candidate, victim) {
+		return true
+	}
+	h.reject(candidate)
+	return false
+}
+
+func (h *hooks) reject(candidate Pair) {
+	send(h.rejected, h.rblock, candidate)
+}
+
+// Pin a key which must exist in the cache.
+func (h *hooks) pin(key interface{}) {
+	if h.pins == nil {
+		h.pins = make(map[interface{}]int)
+	}
+	h.pins[key]++
+}
+
+func (h *hooks) Unpin(key interface{}) (hit bool) {
+	var n int
+	if n, hit = h.pins[key]; hit {
+		if n == 1 {
+			delete(h.pins, key)
+		} else {
+			h.pins[key] = n - 1
+		}
+	}
+	return
+}
+
+func (h *hooks) pinned(key interface{}) bool {
+	_, ok := h.pins[key]
+	return ok
+}
+
+// Return whether all n items of a cache are pinned.
+func (h *hooks) allPinned(n int) bool {
+	return len(h.pins) >= n
+}
+
+// Forget all pins of a key no longer in the cache.
+func (h *hooks) unpinAll(key interface{}) {
+	delete(h.pins, key)
+}
+
+// Return an empty, closed cache. Wrappers use it in place of the caches they
+// wrap once closed.
+func closedCache() Cache {
+	c := NewFIFO(1)
+	_ = c.Close()
+	return c
+}
+
+func notify(listeners []func(EvictionEvent), p Pair) {
+	for _, f := range listeners {
+		f(EvictionEvent{Pair: p})
+	}
+}
+
 func send(e chan<- Pair, block bool, p Pair) {
 	if e == nil {
 		return
@@ -16,10 +16,14 @@ type cache struct {
 func freshCaches(capacity int) []cache {
 	return []cache{
 		{"FIFO", NewFIFO(capacity)},
+		{"FIFOReinsertion", NewFIFOReinsertion(capacity)},
 		{"LFU", NewLFU(capacity)},
 		{"LIFO", NewLIFO(capacity)},
+		{"LRFU", NewLRFU(capacity, 0.5)},
 		{"LRU", NewLRU(capacity)},
 		{"MRU", NewMRU(capacity)},
+		{"OPT", NewOPT(capacity, nil)},
+		{"RandomK", NewRandomK(capacity, 2, nil)},
 		{"RR", NewRR(capacity, nil)},
 	}
 }
@@ -92,6 +96,277 @@ func testCoherent(c Cache) error {
 	return nil
 }
 
+func TestContains(t *testing.T) {
+	for _, c := range freshCaches(2) {
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+
+		if !c.cache.Contains(1) || c.cache.Contains(3) {
+			t.Fatalf("%s: contains", c.name)
+		}
+
+		if keys := c.cache.Keys(); len(keys) != 2 {
+			t.Fatalf("%s: keys %v", c.name, keys)
+		}
+
+		if n := c.cache.Cap(); n != 2 {
+			t.Fatalf("%s: cap %d", c.name, n)
+		}
+	}
+
+	// Contains is not an access.
+	c := NewLRU(2)
+	c.Add(1, 1)
+	c.Add(2, 2)
+	c.Contains(1)
+	c.Add(3, 3)
+	if c.Contains(1) {
+		t.Fatal("1 not evicted")
+	}
+}
+
+func TestNextVictim(t *testing.T) {
+	for _, c := range freshCaches(2) {
+		p, ok := c.cache.(Previewer)
+		if !ok {
+			continue
+		}
+
+		if _, ok := p.NextVictim(); ok {
+			t.Fatalf("%s: victim of empty cache", c.name)
+		}
+
+		evicted := make(chan Pair, 1)
+		c.cache.Eviction(evicted, false)
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+
+		victim, ok := p.NextVictim()
+		if !ok {
+			t.Fatalf("%s: no victim", c.name)
+		}
+
+		c.cache.Add(3, 3)
+		if e := <-evicted; e != victim {
+			t.Fatalf("%s: evicted %v, previewed %v", c.name, e, victim)
+		}
+	}
+
+	// Locked caches are only Previewers if the caches they wrap are.
+	if _, ok := NewLocked(NewBuffered(NewLRU(2))).(Previewer); ok {
+		t.Fatal("locked buffered cache is a Previewer")
+	}
+}
+
+func TestPin(t *testing.T) {
+	for _, c := range freshCaches(2) {
+		rejected := make(chan Pair, 1)
+		c.cache.Admission(nil, rejected, false)
+
+		if c.cache.Pin(1) {
+			t.Fatalf("%s: pin missing 1", c.name)
+		}
+
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+		c.cache.Pin(1)
+		c.cache.Pin(1)
+		c.cache.Pin(2)
+
+		// The cache is full of pinned items, so 3 is dropped.
+		if c.cache.Add(3, 3) || c.cache.Contains(3) || c.cache.Len() != 2 {
+			t.Fatalf("%s: 3 added to pinned cache", c.name)
+		}
+		if p := <-rejected; p.Key != 3 {
+			t.Fatalf("%s: rejected %v", c.name, p.Key)
+		}
+
+		if !c.cache.Unpin(1) || !c.cache.Unpin(2) {
+			t.Fatalf("%s: unpin", c.name)
+		}
+
+		// 2 is the only unpinned item, so it is evicted.
+		c.cache.Add(3, 3)
+		if _, hit := c.cache.Get(2); hit {
+			t.Fatalf("%s: 2 not evicted", c.name)
+		}
+		if _, hit := c.cache.Get(1); !hit {
+			t.Fatalf("%s: pinned 1 evicted", c.name)
+		}
+
+		if !c.cache.Unpin(1) || c.cache.Unpin(1) {
+			t.Fatalf("%s: unpin 1", c.name)
+		}
+	}
+}
+
+// zeroReader reads only zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestPinRandom(t *testing.T) {
+	// The source always draws the first item, which is pinned.
+	for _, c := range []cache{
+		{"RandomK", NewRandomK(2, 2, zeroReader{})},
+		{"RR", NewRR(2, zeroReader{})},
+	} {
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+		c.cache.Pin(1)
+		c.cache.Add(3, 3)
+		if !c.cache.Contains(1) || c.cache.Contains(2) || !c.cache.Contains(3) {
+			t.Fatalf("%s: keys %v", c.name, c.cache.Keys())
+		}
+	}
+}
+
+func TestDeleteLast(t *testing.T) {
+	for _, c := range freshCaches(4) {
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+		if !c.cache.Delete(2) {
+			t.Fatalf("%s: delete 2", c.name)
+		}
+		if dump := c.cache.Dump(); len(dump) != 1 || dump[0].Key != 1 {
+			t.Fatalf("%s: dump %v", c.name, dump)
+		}
+		if !c.cache.Delete(1) || len(c.cache.Dump()) != 0 {
+			t.Fatalf("%s: delete 1", c.name)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	caches := freshCaches(2)
+	caches = append(caches,
+		cache{"Locked", NewLocked(NewLRU(2))},
+		cache{"Segmented", NewSegmented(NewFIFO(1), NewLRU(1))},
+		cache{"Ghosted", NewGhosted(NewLRU(2), 2)},
+		cache{"Doorkeeper", NewDoorkeeper(NewLRU(2), 2, 0.01)},
+		cache{"Loading", NewLoading(NewLRU(2), nil, LoadingOptions{})},
+		cache{"Backed", NewBacked(NewLRU(2), newMapStore(), WriteBack)},
+	)
+
+	d, err := NewDiskTier(t.TempDir(), 1<<12, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caches = append(caches, cache{"Disk", d})
+
+	for _, c := range caches {
+		c.cache.Add(1, 1)
+		if err := c.cache.Close(); err != nil {
+			t.Fatalf("%s: close: %v", c.name, err)
+		}
+
+		if err := c.cache.Close(); err != ErrClosed {
+			t.Fatalf("%s: close closed: %v", c.name, err)
+		}
+
+		if _, hit := c.cache.Get(1); hit {
+			t.Fatalf("%s: get 1 after close", c.name)
+		}
+
+		c.cache.Add(2, 2)
+		c.cache.Add(3, 3)
+		c.cache.Set(2, 2)
+		c.cache.Pin(2)
+		c.cache.Clear()
+
+		if c.cache.Len() != 0 || c.cache.Cap() != 0 || len(c.cache.Dump()) != 0 {
+			t.Fatalf("%s: not empty after close", c.name)
+		}
+	}
+}
+
+func TestCloseWrapped(t *testing.T) {
+	wrappers := map[string]func(c Cache) Cache{
+		"Locked":   NewLocked,
+		"RWLocked": NewRWLocked,
+		"Segmented": func(c Cache) Cache {
+			return NewSegmented(NewLRU(1), c)
+		},
+		"ConcurrentSegmented": func(c Cache) Cache {
+			return NewConcurrentSegmented(NewLRU(1), c)
+		},
+		"Ghosted": func(c Cache) Cache {
+			return NewGhosted(c, 2)
+		},
+		"Doorkeeper": func(c Cache) Cache {
+			return NewDoorkeeper(c, 2, 0.01)
+		},
+		"Buffered": func(c Cache) Cache {
+			return NewBuffered(c)
+		},
+		"Loading": func(c Cache) Cache {
+			return NewLoading(c, nil, LoadingOptions{})
+		},
+		"Backed": func(c Cache) Cache {
+			return NewBacked(c, newMapStore(), WriteThrough)
+		},
+	}
+
+	for name, wrap := range wrappers {
+		c := NewLRU(2)
+		if err := wrap(c).Close(); err != nil {
+			t.Fatalf("%s: close: %v", name, err)
+		}
+		if err := c.Close(); err != ErrClosed {
+			t.Fatalf("%s: wrapped cache not closed: %v", name, err)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	for _, c := range freshCaches(8) {
+		evicted := make(chan Pair, 8)
+		c.cache.Eviction(evicted, true)
+		for i := 0; i < 8; i++ {
+			c.cache.Add(i, i)
+		}
+		c.cache.Pin(0)
+
+		r := c.cache.(Resizer)
+		r.Resize(4)
+		if n := c.cache.Len(); n != 4 || len(evicted) != 4 || !c.cache.Contains(0) {
+			t.Fatalf("%s: len %d, evicted %d", c.name, n, len(evicted))
+		}
+
+		r.Resize(6)
+		for i := 8; i < 12; i++ {
+			c.cache.Add(i, i)
+		}
+		if n, size := c.cache.Len(), c.cache.Cap(); n != 6 || size != 6 {
+			t.Fatalf("%s: len %d, cap %d", c.name, n, size)
+		}
+	}
+}
+
+func TestFIFOReinsertion(t *testing.T) {
+	c := NewFIFOReinsertion(2)
+	c.Add(1, 1)
+	c.Add(2, 2)
+	c.Get(1)
+
+	// 1 was accessed and is given another lap, so 2 is evicted.
+	c.Add(3, 3)
+	if _, hit := c.Get(2); hit {
+		t.Fatal("2 not evicted")
+	}
+
+	// 1 was reinserted without its access, so it is evicted next.
+	c.Add(4, 4)
+	if _, hit := c.Get(1); hit {
+		t.Fatal("1 not evicted")
+	}
+}
+
 func BenchmarkAddFrequencies(b *testing.B) {
 	dists := []struct {
 		name string
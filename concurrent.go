@@ -0,0 +1,297 @@
+package cache
+
+import "sync"
+
+type concurrent struct {
+	core  *segmented
+	tiers []Cache
+	locks []sync.Mutex
+
+	closed bool
+}
+
+// NewConcurrentSegmented constructs a new segmented cache which is safe for
+// concurrent use, behaving as NewSegmented except that an Add of a key held by
+// a higher internal cache hits instead of adding a duplicate. The returned
+// cache is Atomic.
+//
+// Each internal cache has its own lock, so that a Get hit in the highest cache
+// does not wait on operations in lower caches. Operations which may move items
+// between internal caches lock the lowest cache first, then each higher cache
+// they touch in ascending order, so items are never lost or duplicated between
+// internal caches and locks are never acquired in conflicting orders.
+func NewConcurrentSegmented(caches ...Cache) Segmented {
+	if len(caches) == 0 {
+		panic("segmented: no caches specified")
+	}
+
+	c := &concurrent{
+		core:  NewSegmented(caches...).(*segmented),
+		tiers: make([]Cache, len(caches)),
+		locks: make([]sync.Mutex, len(caches)),
+	}
+
+	copy(c.tiers, caches)
+	return c
+}
+
+// Get checks the highest internal cache under its own lock, and each lower
+// internal cache under the locks of the caches a hit in it may move items
+// between, so that a hit is promoted without looking it up again. Since a key
+// moving between internal caches may be missed, a miss is confirmed while no
+// items can move.
+func (c *concurrent) Get(key interface{}) (value interface{}, hit bool) {
+	top := len(c.tiers) - 1
+	c.locks[top].Lock()
+	closed := c.closed
+	if !closed {
+		if value, hit = c.tiers[top].Get(key); hit {
+			c.core.stats[top].Hits++
+		}
+	}
+	c.locks[top].Unlock()
+	if hit || closed {
+		return
+	}
+
+	for i := top - 1; i >= 0; i-- {
+		if value, hit, closed = c.get(i, key); hit || closed {
+			return
+		}
+	}
+
+	c.lock(top)
+	defer c.unlock(top)
+	if !c.closed {
+		value, hit = c.core.Get(key)
+	}
+	return
+}
+
+func (c *concurrent) Add(key, value interface{}) (hit bool) {
+	c.locks[0].Lock()
+	defer c.locks[0].Unlock()
+	if c.closed {
+		return
+	}
+
+	for i := len(c.tiers) - 1; i > 0; i-- {
+		c.locks[i].Lock()
+		hit = c.tiers[i].Contains(key)
+		c.locks[i].Unlock()
+		if hit {
+			return
+		}
+	}
+	return c.core.Add(key, value)
+}
+
+func (c *concurrent) Set(key, value interface{}) (hit bool) {
+	c.locks[0].Lock()
+	defer c.locks[0].Unlock()
+	if c.closed {
+		return
+	}
+
+	for i := len(c.tiers) - 1; i > 0; i-- {
+		c.locks[i].Lock()
+		hit = c.tiers[i].Set(key, value)
+		evicted := len(c.core.evicted[i]) > 0
+		c.locks[i].Unlock()
+
+		// A Set may evict from a disk tier, and its values move down
+		// while every lock up to it is held.
+		if evicted {
+			for j := 1; j <= i; j++ {
+				c.locks[j].Lock()
+			}
+			c.core.trickle(i)
+			for j := i; j > 0; j-- {
+				c.locks[j].Unlock()
+			}
+		}
+		if hit {
+			return
+		}
+	}
+	hit = c.tiers[0].Set(key, value)
+	c.core.trickle(0)
+	return
+}
+
+func (c *concurrent) Delete(key interface{}) (hit bool) {
+	c.locks[0].Lock()
+	defer c.locks[0].Unlock()
+	if c.closed {
+		return
+	}
+
+	for i := len(c.tiers) - 1; i > 0; i-- {
+		c.locks[i].Lock()
+		hit = c.tiers[i].Delete(key)
+		c.locks[i].Unlock()
+		if hit {
+			c.core.forget(key)
+			return
+		}
+	}
+	if hit = c.tiers[0].Delete(key); hit {
+		c.core.forget(key)
+	}
+	return
+}
+
+func (c *concurrent) Clear() {
+	c.atomically(func(s *segmented) {
+		s.Clear()
+	})
+}
+
+func (c *concurrent) Len() (n int) {
+	c.atomically(func(s *segmented) {
+		n = s.Len()
+	})
+	return
+}
+
+func (c *concurrent) Contains(key interface{}) (hit bool) {
+	c.atomically(func(s *segmented) {
+		hit = s.Contains(key)
+	})
+	return
+}
+
+func (c *concurrent) Keys() (keys []interface{}) {
+	c.atomically(func(s *segmented) {
+		keys = s.Keys()
+	})
+	return
+}
+
+// Cap returns the sum of the capacities of the internal caches.
+func (c *concurrent) Cap() (n int) {
+	c.atomically(func(s *segmented) {
+		n = s.Cap()
+	})
+	return
+}
+
+func (c *concurrent) Caps() (caps []int) {
+	c.atomically(func(s *segmented) {
+		caps = s.Caps()
+	})
+	return
+}
+
+func (c *concurrent) Tiers() (tiers []TierStats) {
+	c.atomically(func(s *segmented) {
+		tiers = s.Tiers()
+	})
+	return
+}
+
+func (c *concurrent) Eviction(e chan<- Pair, block bool) {
+	c.locks[0].Lock()
+	defer c.locks[0].Unlock()
+	if !c.closed {
+		c.core.Eviction(e, block)
+	}
+}
+
+func (c *concurrent) OnEvict(f func(EvictionEvent)) {
+	c.locks[0].Lock()
+	defer c.locks[0].Unlock()
+	if !c.closed {
+		c.core.OnEvict(f)
+	}
+}
+
+// Admission applies to items added to, or demoted into, the lowest internal
+// cache.
+func (c *concurrent) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	c.locks[0].Lock()
+	defer c.locks[0].Unlock()
+	if !c.closed {
+		c.core.Admission(a, rejected, block)
+	}
+}
+
+func (c *concurrent) Pin(key interface{}) (hit bool) {
+	c.atomically(func(s *segmented) {
+		hit = s.Pin(key)
+	})
+	return
+}
+
+func (c *concurrent) Unpin(key interface{}) (hit bool) {
+	c.atomically(func(s *segmented) {
+		hit = s.Unpin(key)
+	})
+	return
+}
+
+func (c *concurrent) Dump() (pairs []Pair) {
+	c.atomically(func(s *segmented) {
+		pairs = s.Dump()
+	})
+	return
+}
+
+// Close closes the input caches.
+func (c *concurrent) Close() error {
+	top := len(c.tiers) - 1
+	c.lock(top)
+	defer c.unlock(top)
+	if c.closed {
+		return ErrClosed
+	}
+	c.closed = true
+	return c.core.Close()
+}
+
+// Atomically calls f with a segmented cache of the internal caches, holding
+// every lock.
+func (c *concurrent) Atomically(f func(c Cache)) {
+	c.atomically(func(s *segmented) {
+		f(s)
+	})
+}
+
+// Run f with the segmented cache while holding every lock. Once closed, the
+// segmented cache acts as an empty one.
+func (c *concurrent) atomically(f func(s *segmented)) {
+	top := len(c.tiers) - 1
+	c.lock(top)
+	defer c.unlock(top)
+	f(c.core)
+}
+
+// Get key from lower internal cache i, promoting it on a hit. Returns whether
+// the cache is closed.
+func (c *concurrent) get(i int, key interface{}) (value interface{}, hit, closed bool) {
+	c.lock(i + 1)
+	defer c.unlock(i + 1)
+	if c.closed {
+		return nil, false, true
+	}
+	if value, hit = c.tiers[i].Get(key); hit {
+		c.core.stats[i].Hits++
+		if c.core.promotable(i, key) {
+			c.core.promote(i, key, value)
+		}
+	}
+	return
+}
+
+// Lock internal caches 0 through i in ascending order.
+func (c *concurrent) lock(i int) {
+	for j := 0; j <= i; j++ {
+		c.locks[j].Lock()
+	}
+}
+
+func (c *concurrent) unlock(i int) {
+	for j := i; j >= 0; j-- {
+		c.locks[j].Unlock()
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrentSegmented(t *testing.T) {
+	s := NewConcurrentSegmented(NewFIFO(16), NewLRU(8), NewLRU(4))
+	defer s.Close()
+
+	var evicted int64
+	s.OnEvict(func(EvictionEvent) {
+		atomic.AddInt64(&evicted, 1)
+	})
+
+	var added, deleted int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				key := (i*7 + j*13) % 48
+				switch j % 5 {
+				case 0:
+					if !s.Add(key, j) {
+						atomic.AddInt64(&added, 1)
+					}
+				case 1:
+					s.Set(key, j)
+				case 2:
+					if s.Delete(key) {
+						atomic.AddInt64(&deleted, 1)
+					}
+				default:
+					s.Get(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[interface{}]bool)
+	for _, p := range s.Dump() {
+		if seen[p.Key] {
+			t.Fatalf("duplicate key %v", p.Key)
+		}
+		seen[p.Key] = true
+	}
+
+	// Every added item is still in the cache, deleted, or evicted.
+	if n := int64(s.Len()); n != added-deleted-evicted {
+		t.Fatalf("len %d, added %d, deleted %d, evicted %d", n, added,
+			deleted, evicted)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, hit := s.Get(0); hit {
+		t.Fatal("closed get hit")
+	}
+	if s.Close() != ErrClosed {
+		t.Fatal("closed twice")
+	}
+}
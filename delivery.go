@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Delivery sends evicted key-value pairs through a channel like a blocking
+// eviction channel, except that a send gives up once its timeout passes or its
+// context is done. Events which could not be sent are dropped and counted, so a
+// slow consumer cannot freeze the cache. Register its Listener with OnEvict.
+type Delivery struct {
+	ctx     context.Context
+	e       chan<- Pair
+	timeout time.Duration
+
+	dropped uint64
+	stalled int32
+}
+
+// NewDelivery constructs a new delivery through e, which waits for up to
+// timeout for each send, or until ctx is done. A timeout <= 0 waits only for
+// ctx.
+func NewDelivery(ctx context.Context, e chan<- Pair, timeout time.Duration) *Delivery {
+	return &Delivery{
+		ctx:     ctx,
+		e:       e,
+		timeout: timeout,
+	}
+}
+
+// Listener sends the evicted pair of an event through the channel.
+func (d *Delivery) Listener(event EvictionEvent) {
+	select {
+	case d.e <- event.Pair:
+		atomic.StoreInt32(&d.stalled, 0)
+		return
+	default:
+	}
+
+	var expired <-chan time.Time
+	if d.timeout > 0 {
+		t := time.NewTimer(d.timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	select {
+	case d.e <- event.Pair:
+		atomic.StoreInt32(&d.stalled, 0)
+	case <-expired:
+		atomic.AddUint64(&d.dropped, 1)
+		atomic.StoreInt32(&d.stalled, 1)
+	case <-d.ctx.Done():
+		atomic.AddUint64(&d.dropped, 1)
+	}
+}
+
+// Dropped returns the number of pairs which could not be sent.
+func (d *Delivery) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Stalled returns whether the most recent send timed out, which suggests the
+// consumer of the channel has stalled. It is reset by the next successful
+// send.
+func (d *Delivery) Stalled() bool {
+	return atomic.LoadInt32(&d.stalled) != 0
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelivery(t *testing.T) {
+	evicted := make(chan Pair, 1)
+	d := NewDelivery(context.Background(), evicted, time.Millisecond)
+
+	c := NewLocked(NewLRU(1))
+	c.OnEvict(d.Listener)
+
+	// No one receives from the channel, so once it is full Add drops the
+	// pair after the timeout instead of blocking.
+	for i := 0; i < 3; i++ {
+		c.Add(i, i)
+	}
+
+	if n := d.Dropped(); n != 1 {
+		t.Fatalf("dropped %d", n)
+	}
+
+	if !d.Stalled() {
+		t.Fatal("not stalled")
+	}
+
+	<-evicted
+	c.Add(3, 3)
+	if d.Stalled() {
+		t.Fatal("still stalled")
+	}
+}
+
+func TestDeliveryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	d := NewDelivery(ctx, make(chan Pair), 0)
+	c := NewLRU(1)
+	c.OnEvict(d.Listener)
+	c.Add(1, 1)
+	c.Add(2, 2)
+
+	if n := d.Dropped(); n != 1 {
+		t.Fatalf("dropped %d", n)
+	}
+}
@@ -0,0 +1,751 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes and decodes the keys and values of a disk tier. Decoded keys
+// must be comparable, and equal to the keys they were encoded from.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// DiskTier represents a cache stored on disk.
+type DiskTier interface {
+	Closer
+
+	// Compact rewrites the items into new segment files, reclaiming the
+	// space of deleted, evicted, and overwritten items.
+	Compact() error
+
+	// Err returns the first error since the last call to Err. Operations
+	// which fail leave the cache unchanged, except that a Set which fails
+	// removes the item, and Get misses.
+	Err() error
+}
+
+// Each record is a header followed by the key and value. The checksum covers
+// the rest of the header, the key, and the value.
+const (
+	recordHeader = 4 + 1 + 4 + 4
+
+	recordPut    = 1
+	recordDelete = 2
+
+	segmentExt = ".seg"
+)
+
+type disk struct {
+	capacity    int64
+	dir         string
+	codec       Codec
+	segmentSize int64
+
+	segments map[uint64]*os.File
+	active   uint64
+	size     int64
+
+	cache map[interface{}]*list.Element
+	list  *list.List
+	live  int64
+	dead  int64
+
+	err error
+
+	hooks
+}
+
+// diskEntry locates the latest record of an item.
+type diskEntry struct {
+	key     interface{}
+	segment uint64
+	offset  int64
+	size    int64
+	value   int64
+}
+
+// NewDiskTier constructs a new first-in first-out cache stored in dir, which
+// holds up to capacityBytes bytes of records, and in which keys and values are
+// encoded by codec. Items least-recently added or set are evicted first.
+//
+// Records are appended to segment files, and an in-memory index locates the
+// latest record of each item. Deleted and evicted items are recorded as well,
+// and once such dead records outweigh the live ones, the items are compacted
+// into new segment files. The index is rebuilt by scanning the segment files
+// of dir, so the cache recovers the items of a previous disk tier in the same
+// directory, discarding records torn by a crash. Writes are synced to disk by
+// Compact and Close. Closing the cache keeps its segment files.
+//
+// Get reads from disk, and Add and Set write to disk before returning. A Set of
+// a value which cannot be written, such as one too large to fit or one which
+// would need a pinned item evicted, removes the item and misses as a rejected
+// Add does. Unlike Add, Set does not consult the admitter. Cap and Resize are
+// in bytes. This function panics if capacityBytes <= 0.
+func NewDiskTier(dir string, capacityBytes int64, codec Codec) (DiskTier, error) {
+	if capacityBytes <= 0 {
+		panic("disk: capacity <= 0")
+	}
+
+	d := &disk{
+		capacity:    capacityBytes,
+		dir:         dir,
+		codec:       codec,
+		segmentSize: capacityBytes / 4,
+		segments:    make(map[uint64]*os.File),
+		cache:       make(map[interface{}]*list.Element),
+		list:        list.New(),
+	}
+
+	if d.segmentSize < 1<<12 {
+		d.segmentSize = 1 << 12
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := d.recover(); err != nil {
+		_ = d.closeFiles()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *disk) Get(key interface{}) (value interface{}, hit bool) {
+	var item *list.Element
+	if item, hit = d.cache[key]; !hit {
+		return
+	}
+	var err error
+	if value, err = d.read(item.Value.(*diskEntry)); err != nil {
+		d.fail(err)
+		return nil, false
+	}
+	return
+}
+
+func (d *disk) Add(key, value interface{}) (hit bool) {
+	if _, hit = d.cache[key]; hit {
+		return
+	}
+
+	k, v, ok := d.encode(key, value)
+	if !ok {
+		return
+	}
+
+	size := int64(recordHeader + len(k) + len(v))
+	if !d.fit(Pair{key, value}, size, nil) {
+		return
+	}
+
+	if entry, ok := d.append(recordPut, key, k, v); ok {
+		d.cache[key] = d.list.PushFront(entry)
+		d.live += entry.size
+	}
+	d.compact()
+	return
+}
+
+func (d *disk) Set(key, value interface{}) (hit bool) {
+	var item *list.Element
+	if item, hit = d.cache[key]; !hit {
+		return
+	}
+
+	old := item.Value.(*diskEntry)
+	k, v, ok := d.encode(key, value)
+	var entry *diskEntry
+	if ok {
+		size := int64(recordHeader + len(k) + len(v))
+		if size > d.capacity {
+			d.reject(Pair{key, value})
+		} else if d.fit(Pair{key, value}, size-old.size, item) {
+			entry, _ = d.append(recordPut, key, k, v)
+		}
+	}
+
+	// The new value could not be written, so the item is removed rather
+	// than keeping the old value.
+	if entry == nil {
+		_ = d.remove(item)
+		d.compact()
+		return false
+	}
+
+	item.Value = entry
+	d.list.MoveToFront(item)
+	d.live += entry.size - old.size
+	d.dead += old.size
+	d.compact()
+	return
+}
+
+func (d *disk) Delete(key interface{}) (hit bool) {
+	var item *list.Element
+	if item, hit = d.cache[key]; hit {
+		_ = d.remove(item)
+		d.compact()
+	}
+	return
+}
+
+// Clear removes the segment files of the cache.
+func (d *disk) Clear() {
+	if d.closed {
+		return
+	}
+
+	for id, f := range d.segments {
+		_ = f.Close()
+		if err := os.Remove(f.Name()); err != nil {
+			d.fail(err)
+		}
+		delete(d.segments, id)
+	}
+
+	d.cache = make(map[interface{}]*list.Element)
+	d.list = d.list.Init()
+	d.live, d.dead = 0, 0
+	d.pins = nil
+
+	if err := d.rotate(); err != nil {
+		d.fail(err)
+	}
+}
+
+// Close syncs and closes the segment files, which are kept, and leaves the
+// cache with no capacity and no hooks.
+func (d *disk) Close() error {
+	if d.closed {
+		return ErrClosed
+	}
+
+	err := d.closeFiles()
+	d.cache = make(map[interface{}]*list.Element)
+	d.list = d.list.Init()
+	d.live, d.dead = 0, 0
+	d.capacity = 0
+	d.hooks = hooks{closed: true}
+	return err
+}
+
+func (d *disk) Len() int {
+	return len(d.cache)
+}
+
+func (d *disk) Contains(key interface{}) (hit bool) {
+	_, hit = d.cache[key]
+	return
+}
+
+func (d *disk) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(d.cache))
+	for k := range d.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (d *disk) Cap() int {
+	return int(d.capacity)
+}
+
+// Resize sets the capacity in bytes.
+func (d *disk) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("disk: capacity <= 0")
+	}
+	if d.closed {
+		return
+	}
+
+	d.capacity = int64(capacity)
+	for d.live > d.capacity {
+		item := d.victim()
+		if item == nil || !d.evictItem(item) {
+			break
+		}
+	}
+	d.compact()
+}
+
+func (d *disk) Pin(key interface{}) (hit bool) {
+	if _, hit = d.cache[key]; hit {
+		d.pin(key)
+	}
+	return
+}
+
+// Dump reads every item from disk. Items which cannot be read are left out.
+func (d *disk) Dump() []Pair {
+	pairs := make([]Pair, 0, len(d.cache))
+	for k, item := range d.cache {
+		value, err := d.read(item.Value.(*diskEntry))
+		if err != nil {
+			d.fail(err)
+			continue
+		}
+		pairs = append(pairs, Pair{k, value})
+	}
+	return pairs
+}
+
+func (d *disk) Err() error {
+	err := d.err
+	d.err = nil
+	return err
+}
+
+func (d *disk) Compact() error {
+	if d.closed {
+		return ErrClosed
+	}
+
+	// Copy the records of the items, oldest first, so that replaying the
+	// new segments after any old ones which survive a crash restores the
+	// same items.
+	old := d.segments
+	d.segments = make(map[uint64]*os.File)
+	if err := d.rotate(); err != nil {
+		d.segments = old
+		return err
+	}
+
+	for item := d.list.Back(); item != nil; item = item.Prev() {
+		entry := item.Value.(*diskEntry)
+		record := make([]byte, entry.size)
+		if _, err := old[entry.segment].ReadAt(record, entry.offset); err != nil {
+			d.abort(old)
+			return err
+		}
+		moved, err := d.write(entry.key, record)
+		if err != nil {
+			d.abort(old)
+			return err
+		}
+		item.Value = moved
+	}
+
+	if err := d.segments[d.active].Sync(); err != nil {
+		d.abort(old)
+		return err
+	}
+
+	for _, id := range sortedIDs(old) {
+		_ = old[id].Close()
+		if err := os.Remove(old[id].Name()); err != nil {
+			return err
+		}
+	}
+
+	d.dead = 0
+	return nil
+}
+
+// Compact once dead records outweigh the live ones, and fill a segment.
+func (d *disk) compact() {
+	if d.dead > d.live && d.dead > d.segmentSize {
+		if err := d.Compact(); err != nil {
+			d.fail(err)
+		}
+	}
+}
+
+// Return to the old segments after a failed compaction.
+func (d *disk) abort(old map[uint64]*os.File) {
+	for id, f := range d.segments {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		delete(d.segments, id)
+	}
+	d.segments = old
+
+	d.active = 0
+	for id := range old {
+		if id > d.active {
+			d.active = id
+		}
+	}
+	if fi, err := old[d.active].Stat(); err == nil {
+		d.size = fi.Size()
+	}
+
+	// Entries already moved point to removed segments, so the index is
+	// rebuilt.
+	d.cache = make(map[interface{}]*list.Element)
+	d.list = d.list.Init()
+	d.live, d.dead = 0, 0
+	for _, id := range sortedIDs(old) {
+		if err := d.scan(id, old[id]); err != nil {
+			d.fail(err)
+		}
+	}
+}
+
+// Make room for size more bytes, evicting items other than item. Returns false
+// if the candidate was rejected. The admitter is only consulted for a new item,
+// so a Set evicts as needed, as in every other cache.
+func (d *disk) fit(candidate Pair, size int64, item *list.Element) bool {
+	if d.live+size <= d.capacity {
+		return true
+	}
+	if size > d.capacity {
+		d.reject(candidate)
+		return false
+	}
+
+	admitted := item != nil
+	for d.live+size > d.capacity {
+		victim := d.victim()
+		if victim == item {
+			victim = d.prevVictim(victim)
+		}
+		if victim == nil {
+			d.reject(candidate)
+			return false
+		}
+		if !admitted {
+			value, err := d.read(victim.Value.(*diskEntry))
+			if err != nil {
+				d.fail(err)
+				return false
+			}
+			if !d.admit(candidate, Pair{victim.Value.(*diskEntry).key, value}) {
+				return false
+			}
+			admitted = true
+		}
+		if !d.evictItem(victim) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the next item to evict, skipping pinned items. Returns nil if every
+// item is pinned.
+func (d *disk) victim() *list.Element {
+	if d.allPinned(len(d.cache)) {
+		return nil
+	}
+	return d.prevVictim(nil)
+}
+
+// Return the first unpinned item before item, or from the back of the list if
+// item is nil.
+func (d *disk) prevVictim(item *list.Element) *list.Element {
+	if item == nil {
+		item = d.list.Back()
+	} else {
+		item = item.Prev()
+	}
+	for item != nil && d.pinned(item.Value.(*diskEntry).key) {
+		item = item.Prev()
+	}
+	return item
+}
+
+// Evict an item. Returns false if it could not be removed.
+func (d *disk) evictItem(item *list.Element) bool {
+	entry := item.Value.(*diskEntry)
+	value, err := d.read(entry)
+	if !d.remove(item) {
+		return false
+	}
+	if err != nil {
+		d.fail(err)
+	} else {
+		d.evict(Pair{entry.key, value})
+	}
+	return true
+}
+
+// Record the deletion of an item, and remove it from the index. Returns false
+// if the deletion could not be recorded.
+func (d *disk) remove(item *list.Element) bool {
+	entry := item.Value.(*diskEntry)
+	k, err := d.codec.Encode(entry.key)
+	if err != nil {
+		d.fail(err)
+		return false
+	}
+	tombstone, ok := d.append(recordDelete, entry.key, k, nil)
+	if !ok {
+		return false
+	}
+
+	delete(d.cache, entry.key)
+	d.unpinAll(entry.key)
+	d.list.Remove(item)
+	d.live -= entry.size
+	d.dead += entry.size + tombstone.size
+	return true
+}
+
+func (d *disk) encode(key, value interface{}) (k, v []byte, ok bool) {
+	var err error
+	if k, err = d.codec.Encode(key); err != nil {
+		d.fail(err)
+		return
+	}
+	if v, err = d.codec.Encode(value); err != nil {
+		d.fail(err)
+		return
+	}
+	return k, v, true
+}
+
+// Append a record to the active segment.
+func (d *disk) append(op byte, key interface{}, k, v []byte) (*diskEntry, bool) {
+	record := make([]byte, recordHeader+len(k)+len(v))
+	record[4] = op
+	binary.LittleEndian.PutUint32(record[5:], uint32(len(k)))
+	binary.LittleEndian.PutUint32(record[9:], uint32(len(v)))
+	copy(record[recordHeader:], k)
+	copy(record[recordHeader+len(k):], v)
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+
+	entry, err := d.write(key, record)
+	if err != nil {
+		d.fail(err)
+		return nil, false
+	}
+	return entry, true
+}
+
+// Write an encoded record to the active segment, rotating it once full.
+func (d *disk) write(key interface{}, record []byte) (*diskEntry, error) {
+	if d.size > 0 && d.size+int64(len(record)) > d.segmentSize {
+		if err := d.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	f := d.segments[d.active]
+	if _, err := f.WriteAt(record, d.size); err != nil {
+		// Drop a partially written record.
+		_ = f.Truncate(d.size)
+		return nil, err
+	}
+
+	klen := int64(binary.LittleEndian.Uint32(record[5:]))
+	entry := &diskEntry{
+		key:     key,
+		segment: d.active,
+		offset:  d.size,
+		size:    int64(len(record)),
+		value:   d.size + recordHeader + klen,
+	}
+	d.size += int64(len(record))
+	return entry, nil
+}
+
+// Start a new active segment.
+func (d *disk) rotate() error {
+	id := d.active + 1
+	for _, f := range d.segments {
+		_ = f.Sync()
+	}
+
+	f, err := os.OpenFile(d.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	d.segments[id] = f
+	d.active = id
+	d.size = 0
+	return nil
+}
+
+func (d *disk) read(entry *diskEntry) (interface{}, error) {
+	buf := make([]byte, entry.offset+entry.size-entry.value)
+	if _, err := d.segments[entry.segment].ReadAt(buf, entry.value); err != nil {
+		return nil, err
+	}
+	return d.codec.Decode(buf)
+}
+
+// Rebuild the index from the segment files, and open the last one for writing.
+func (d *disk) recover() error {
+	names, err := filepath.Glob(filepath.Join(d.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		f, err := os.OpenFile(name, os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		d.segments[id] = f
+	}
+
+	for _, id := range sortedIDs(d.segments) {
+		if err := d.scan(id, d.segments[id]); err != nil {
+			return err
+		}
+		d.active = id
+	}
+
+	if len(d.segments) == 0 {
+		if err := d.rotate(); err != nil {
+			return err
+		}
+	} else {
+		fi, err := d.segments[d.active].Stat()
+		if err != nil {
+			return err
+		}
+		d.size = fi.Size()
+	}
+
+	for d.live > d.capacity {
+		if !d.remove(d.list.Back()) {
+			break
+		}
+	}
+	return d.Err()
+}
+
+// Replay the records of a segment. A torn or corrupt record, and any after it,
+// are truncated. The lengths in a header are checked against the rest of the
+// segment before its body is read, as they are not yet known to be intact.
+func (d *disk) scan(id uint64, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := &countingReader{r: f}
+
+	for {
+		offset := r.n
+		header := make([]byte, recordHeader)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return d.truncate(f, offset, err)
+		}
+		klen := int64(binary.LittleEndian.Uint32(header[5:]))
+		vlen := int64(binary.LittleEndian.Uint32(header[9:]))
+		if klen+vlen > fi.Size()-r.n {
+			return d.truncate(f, offset, io.ErrUnexpectedEOF)
+		}
+		body := make([]byte, klen+vlen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return d.truncate(f, offset, err)
+		}
+
+		crc := crc32.NewIEEE()
+		_, _ = crc.Write(header[4:])
+		_, _ = crc.Write(body)
+		if crc.Sum32() != binary.LittleEndian.Uint32(header) {
+			return d.truncate(f, offset, errCorrupt)
+		}
+
+		key, err := d.codec.Decode(body[:klen])
+		if err != nil {
+			return err
+		}
+
+		size := recordHeader + klen + vlen
+		if item, ok := d.cache[key]; ok {
+			old := item.Value.(*diskEntry)
+			d.list.Remove(item)
+			delete(d.cache, key)
+			d.live -= old.size
+			d.dead += old.size
+		}
+
+		switch header[4] {
+		case recordPut:
+			d.cache[key] = d.list.PushFront(&diskEntry{
+				key:     key,
+				segment: id,
+				offset:  offset,
+				size:    size,
+				value:   offset + recordHeader + klen,
+			})
+			d.live += size
+		case recordDelete:
+			d.dead += size
+		default:
+			return d.truncate(f, offset, errCorrupt)
+		}
+	}
+}
+
+var errCorrupt = errors.New("disk: corrupt record")
+
+// Truncate a segment at the end of its last whole record.
+func (d *disk) truncate(f *os.File, offset int64, err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	if err == io.ErrUnexpectedEOF || err == errCorrupt {
+		return f.Truncate(offset)
+	}
+	return err
+}
+
+func (d *disk) segmentPath(id uint64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+func (d *disk) closeFiles() error {
+	var err error
+	for id, f := range d.segments {
+		if serr := f.Sync(); err == nil {
+			err = serr
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		delete(d.segments, id)
+	}
+	return err
+}
+
+func (d *disk) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func sortedIDs(segments map[uint64]*os.File) []uint64 {
+	ids := make([]uint64, 0, len(segments))
+	for id := range segments {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// intCodec encodes ints in decimal.
+type intCodec struct{}
+
+func (intCodec) Encode(v interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(v.(int))), nil
+}
+
+func (intCodec) Decode(data []byte) (interface{}, error) {
+	return strconv.Atoi(string(data))
+}
+
+func newDiskTier(t *testing.T, dir string, capacity int64) DiskTier {
+	t.Helper()
+	d, err := NewDiskTier(dir, capacity, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDiskTier(t *testing.T) {
+	// Each record of a single digit key and value is 15 bytes.
+	d := newDiskTier(t, t.TempDir(), 45)
+	defer d.Close()
+
+	evicted := make(chan Pair, 4)
+	d.Eviction(evicted, true)
+
+	for i := 1; i <= 3; i++ {
+		d.Add(i, i)
+	}
+	if !d.Set(1, 4) || !d.Add(1, 5) {
+		t.Fatal("set or add miss")
+	}
+	d.Add(5, 5)
+	if p := <-evicted; p.Key != 2 || p.Value != 2 {
+		t.Fatalf("evicted %v", p)
+	}
+
+	if v, hit := d.Get(1); !hit || v != 4 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+	if !d.Delete(3) || d.Contains(3) || d.Len() != 2 {
+		t.Fatal("delete")
+	}
+
+	// Records which do not fit are rejected.
+	if d.Add(int(1e18), int(1e18)); d.Contains(int(1e18)) {
+		t.Fatal("oversized record added")
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A value too large to fit removes the item, as a rejected Add would.
+	small := newDiskTier(t, t.TempDir(), 20)
+	defer small.Close()
+	small.Add(1, 1)
+	if small.Set(1, 1000000) || small.Contains(1) {
+		t.Fatal("oversized set hit")
+	}
+}
+
+func TestDiskTierSetFull(t *testing.T) {
+	d := newDiskTier(t, t.TempDir(), 45)
+	defer d.Close()
+	for i := 1; i <= 3; i++ {
+		d.Add(i, i)
+	}
+
+	// Set evicts as needed without consulting the admitter.
+	d.Admission(AdmitterFunc(func(candidate, victim Pair) bool {
+		return false
+	}), nil, false)
+	if !d.Set(1, 100) || d.Contains(2) {
+		t.Fatal("set refused by admitter")
+	}
+
+	// A larger value which would need a pinned item evicted removes the
+	// item.
+	d.Pin(1)
+	d.Pin(3)
+	if d.Set(3, 100000000000000) || d.Contains(3) || !d.Contains(1) {
+		t.Fatal("set over pinned items hit")
+	}
+	if v, hit := d.Get(1); !hit || v != 100 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+}
+
+func TestDiskTierRecover(t *testing.T) {
+	dir := t.TempDir()
+	d := newDiskTier(t, dir, 1<<16)
+	for i := 0; i < 100; i++ {
+		d.Add(i, i)
+	}
+	for i := 0; i < 50; i++ {
+		d.Delete(i)
+	}
+	d.Set(99, -99)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tear the last record.
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	last := names[len(names)-1]
+	fi, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(last, fi.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	d = newDiskTier(t, dir, 1<<16)
+	defer d.Close()
+	if d.Len() != 50 {
+		t.Fatalf("len %d", d.Len())
+	}
+	if v, hit := d.Get(99); !hit || v != 99 {
+		t.Fatalf("get torn %v %v", v, hit)
+	}
+	if _, hit := d.Get(0); hit {
+		t.Fatal("get deleted hit")
+	}
+
+	// Recovered items are written after the truncated record.
+	d.Set(98, -98)
+	if err = d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ = filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(names) != 1 {
+		t.Fatalf("segments %d", len(names))
+	}
+	for i := 50; i < 100; i++ {
+		want := i
+		if i == 98 {
+			want = -98
+		}
+		if v, hit := d.Get(i); !hit || v != want {
+			t.Fatalf("get %d %v %v", i, v, hit)
+		}
+	}
+}
+
+func TestDiskTierRecoverHeader(t *testing.T) {
+	dir := t.TempDir()
+	d := newDiskTier(t, dir, 1<<12)
+	d.Add(1, 1)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append a header claiming a body far larger than the segment.
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(names[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []byte{0, 0, 0, 0, recordPut, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if _, err = f.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = newDiskTier(t, dir, 1<<12)
+	defer d.Close()
+	if v, hit := d.Get(1); !hit || v != 1 || d.Len() != 1 {
+		t.Fatalf("get %v %v, len %d", v, hit, d.Len())
+	}
+	if fi, err := os.Stat(names[0]); err != nil || fi.Size() != 15 {
+		t.Fatalf("size %v %v", fi, err)
+	}
+}
+
+func TestDiskTierCompact(t *testing.T) {
+	dir := t.TempDir()
+	d := newDiskTier(t, dir, 1<<12)
+	defer d.Close()
+
+	// Overwriting an item many times compacts it automatically.
+	d.Add(1, 1)
+	for i := 0; i < 1000; i++ {
+		d.Set(1, i)
+	}
+	var size int64
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	if size > 2<<12 {
+		t.Fatalf("size %d", size)
+	}
+	if v, hit := d.Get(1); !hit || v != 999 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskTierSegmented(t *testing.T) {
+	d := newDiskTier(t, t.TempDir(), 45)
+	s := NewSegmented(d, NewLRU(2))
+	defer s.Close()
+
+	evicted := make(chan Pair, 4)
+	s.Eviction(evicted, true)
+
+	if caps := s.Caps(); s.Cap() != 2 || caps[0] != 45 || caps[1] != 2 {
+		t.Fatalf("cap %d, caps %v", s.Cap(), caps)
+	}
+
+	for i := 1; i <= 3; i++ {
+		s.Add(i, i)
+	}
+
+	// The larger record evicts two items from the disk tier at once.
+	s.Add(1000000, 1000000)
+	for _, key := range []interface{}{1, 2} {
+		if p := <-evicted; p.Key != key {
+			t.Fatalf("evicted %v", p.Key)
+		}
+	}
+
+	// Items demoted from the higher cache are written to the disk tier.
+	s.Get(3)
+	s.Get(1000000)
+	s.Add(4, 4)
+	s.Get(4)
+	if v, hit := d.Get(3); !hit || v != 3 || s.Len() != 3 {
+		t.Fatalf("get 3 %v %v, len %d", v, hit, s.Len())
+	}
+}
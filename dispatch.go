@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EvictionEvent describes an item automatically evicted from a cache.
+type EvictionEvent struct {
+	Pair
+}
+
+// OverflowPolicy decides what a Dispatcher does with an event when its queue is
+// full.
+type OverflowPolicy int
+
+// Overflow policies.
+const (
+	// DropNewest drops the event being dispatched.
+	DropNewest OverflowPolicy = iota
+
+	// DropOldest drops the oldest queued event to make room.
+	DropOldest
+
+	// Block waits for room in the queue.
+	Block
+)
+
+type dispatch struct {
+	f     func(EvictionEvent)
+	event EvictionEvent
+}
+
+// Dispatcher calls eviction listeners asynchronously from a single goroutine,
+// in the order events were dispatched. Events wait in a bounded queue, and when
+// the queue is full an OverflowPolicy decides which event is dropped.
+type Dispatcher struct {
+	overflow OverflowPolicy
+	queue    chan dispatch
+	done     chan struct{}
+	dropped  uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewDispatcher constructs a new dispatcher with a queue of the given size, and
+// starts its goroutine. This function panics if size <= 0.
+func NewDispatcher(size int, overflow OverflowPolicy) *Dispatcher {
+	if size <= 0 {
+		panic("dispatcher: size <= 0")
+	}
+
+	d := &Dispatcher{
+		overflow: overflow,
+		queue:    make(chan dispatch, size),
+		done:     make(chan struct{}),
+	}
+
+	go d.run()
+	return d
+}
+
+// Listener wraps f to be called asynchronously by the dispatcher, suitable for
+// registering with OnEvict.
+func (d *Dispatcher) Listener(f func(EvictionEvent)) func(EvictionEvent) {
+	return func(event EvictionEvent) {
+		d.dispatch(dispatch{f, event})
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full or
+// the dispatcher was closed.
+func (d *Dispatcher) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Close the dispatcher, waiting for queued events to be delivered. Events
+// dispatched after Close are dropped.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	<-d.done
+	return nil
+}
+
+func (d *Dispatcher) dispatch(x dispatch) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		atomic.AddUint64(&d.dropped, 1)
+		return
+	}
+
+	switch d.overflow {
+	case Block:
+		d.queue <- x
+	case DropOldest:
+		for {
+			select {
+			case d.queue <- x:
+				return
+			default:
+			}
+			select {
+			case <-d.queue:
+				atomic.AddUint64(&d.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case d.queue <- x:
+		default:
+			atomic.AddUint64(&d.dropped, 1)
+		}
+	}
+}
+
+func (d *Dispatcher) run() {
+	for x := range d.queue {
+		x.f(x.event)
+	}
+	close(d.done)
+}
@@ -0,0 +1,77 @@
+package cache
+
+import "testing"
+
+func TestOnEvict(t *testing.T) {
+	for _, c := range freshCaches(1) {
+		var first, second []interface{}
+		c.cache.OnEvict(func(e EvictionEvent) {
+			first = append(first, e.Key)
+		})
+		c.cache.OnEvict(func(e EvictionEvent) {
+			second = append(second, e.Key)
+		})
+
+		c.cache.Add(1, 1)
+		c.cache.Add(2, 2)
+		c.cache.Delete(2)
+
+		if len(first) != 1 || len(second) != 1 || first[0] != 1 || second[0] != 1 {
+			t.Fatalf("%s: evicted %v %v", c.name, first, second)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan interface{}, 8)
+	d := NewDispatcher(1, DropNewest)
+
+	c := NewLRU(1)
+	c.OnEvict(d.Listener(func(e EvictionEvent) {
+		<-release
+		delivered <- e.Key
+	}))
+
+	// Five items are evicted. At most one is being delivered and one is
+	// queued, and the rest are dropped.
+	for i := 0; i < 6; i++ {
+		c.Add(i, i)
+	}
+	close(release)
+	_ = d.Close()
+
+	if n := d.Dropped(); n < 3 || n > 4 {
+		t.Fatalf("dropped %d", n)
+	}
+	if n := uint64(len(delivered)); n+d.Dropped() != 5 {
+		t.Fatalf("delivered %d", n)
+	}
+}
+
+func TestDispatcherDropOldest(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan interface{}, 8)
+	d := NewDispatcher(1, DropOldest)
+
+	c := NewLRU(1)
+	c.OnEvict(d.Listener(func(e EvictionEvent) {
+		<-release
+		delivered <- e.Key
+	}))
+
+	for i := 0; i < 6; i++ {
+		c.Add(i, i)
+	}
+	close(release)
+	_ = d.Close()
+
+	// The newest event is always delivered.
+	var last interface{}
+	for len(delivered) > 0 {
+		last = <-delivered
+	}
+	if last != 4 {
+		t.Fatalf("last delivered %v", last)
+	}
+}
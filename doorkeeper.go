@@ -0,0 +1,156 @@
+package cache
+
+// Doorkeeper represents a cache which only admits keys once they have been
+// added more than once.
+type Doorkeeper interface {
+	Cache
+
+	// Rejected returns the number of Adds which were not admitted.
+	Rejected() uint64
+
+	// Rejection registers a channel through which pairs which were not
+	// admitted will be sent.
+	Rejection(e chan<- Pair, block bool)
+}
+
+type doorkeeper struct {
+	cache Cache
+
+	filter *bloom
+	window int
+	seen   int
+
+	rejected uint64
+
+	e     chan<- Pair
+	block bool
+
+	closed bool
+}
+
+// NewDoorkeeper wraps a cache, filtering out keys which are only added once.
+// The first Add of a key only records it in a Bloom filter sized for
+// expectedItems keys with a false positive rate of fpRate, and the key is
+// admitted to the input cache on its second Add. After expectedItems keys are
+// recorded, the filter is cleared and a new window begins, in which the keys
+// already in the input cache are recorded again so that they stay admitted.
+// This function panics if expectedItems <= 0 or fpRate is not within (0, 1).
+func NewDoorkeeper(cache Cache, expectedItems int, fpRate float64) Doorkeeper {
+	if expectedItems <= 0 {
+		panic("doorkeeper: expectedItems <= 0")
+	}
+
+	if !(fpRate > 0 && fpRate < 1) {
+		panic("doorkeeper: fpRate outside (0, 1)")
+	}
+
+	return &doorkeeper{
+		cache:  cache,
+		filter: newBloom(expectedItems, fpRate),
+		window: expectedItems,
+	}
+}
+
+func (d *doorkeeper) Get(key interface{}) (value interface{}, hit bool) {
+	return d.cache.Get(key)
+}
+
+func (d *doorkeeper) Add(key, value interface{}) (hit bool) {
+	if d.closed {
+		return
+	}
+
+	if d.filter.add(key) {
+		return d.cache.Add(key, value)
+	}
+
+	if d.seen++; d.seen >= d.window {
+		d.reset()
+	}
+
+	d.rejected++
+	send(d.e, d.block, Pair{Key: key, Value: value})
+	return
+}
+
+func (d *doorkeeper) Set(key, value interface{}) (hit bool) {
+	return d.cache.Set(key, value)
+}
+
+func (d *doorkeeper) Delete(key interface{}) (hit bool) {
+	return d.cache.Delete(key)
+}
+
+func (d *doorkeeper) Clear() {
+	d.cache.Clear()
+	d.filter.reset()
+	d.seen = 0
+}
+
+func (d *doorkeeper) Len() int {
+	return d.cache.Len()
+}
+
+func (d *doorkeeper) Contains(key interface{}) (hit bool) {
+	return d.cache.Contains(key)
+}
+
+func (d *doorkeeper) Keys() []interface{} {
+	return d.cache.Keys()
+}
+
+func (d *doorkeeper) Cap() int {
+	return d.cache.Cap()
+}
+
+func (d *doorkeeper) Eviction(e chan<- Pair, block bool) {
+	d.cache.Eviction(e, block)
+}
+
+func (d *doorkeeper) OnEvict(f func(EvictionEvent)) {
+	d.cache.OnEvict(f)
+}
+
+func (d *doorkeeper) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	d.cache.Admission(a, rejected, block)
+}
+
+func (d *doorkeeper) Pin(key interface{}) (hit bool) {
+	return d.cache.Pin(key)
+}
+
+func (d *doorkeeper) Unpin(key interface{}) (hit bool) {
+	return d.cache.Unpin(key)
+}
+
+func (d *doorkeeper) Dump() []Pair {
+	return d.cache.Dump()
+}
+
+// Close closes the input cache.
+func (d *doorkeeper) Close() error {
+	if d.closed {
+		return ErrClosed
+	}
+	d.closed = true
+	d.e = nil
+	d.filter.reset()
+	return d.cache.Close()
+}
+
+func (d *doorkeeper) Rejected() uint64 {
+	return d.rejected
+}
+
+func (d *doorkeeper) Rejection(e chan<- Pair, block bool) {
+	d.e, d.block = e, block
+}
+
+// Begin a new window, recording the keys already in the input cache.
+func (d *doorkeeper) reset() {
+	d.filter.reset()
+	d.seen = 0
+	for _, p := range d.cache.Dump() {
+		d.filter.add(p.Key)
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDoorkeeper(t *testing.T) {
+	rejected := make(chan Pair, 1)
+	d := NewDoorkeeper(NewLRU(2), 100, 0.01)
+	d.Rejection(rejected, false)
+
+	if d.Add(1, 1) {
+		t.Fatal("add 1->1")
+	}
+
+	if p := <-rejected; p.Key != 1 {
+		t.Fatalf("rejected %v", p.Key)
+	}
+
+	if _, hit := d.Get(1); hit {
+		t.Fatal("1 admitted on first add")
+	}
+
+	d.Add(1, 1)
+	if _, hit := d.Get(1); !hit {
+		t.Fatal("1 not admitted on second add")
+	}
+
+	if !d.Add(1, 1) {
+		t.Fatal("add 1->1 not hit")
+	}
+
+	if r := d.Rejected(); r != 1 {
+		t.Fatalf("rejected %d", r)
+	}
+}
+
+func TestDoorkeeperWindow(t *testing.T) {
+	d := NewDoorkeeper(NewLRU(2), 2, 0.01)
+	d.Add(1, 1)
+	d.Add(2, 2)
+
+	// The window is over, so 1 is seen for the first time again.
+	d.Add(1, 1)
+	if _, hit := d.Get(1); hit {
+		t.Fatal("1 admitted after reset")
+	}
+}
+
+func TestDoorkeeperResident(t *testing.T) {
+	d := NewDoorkeeper(NewLRU(2), 2, 0.01)
+	d.Add(1, 1)
+	d.Add(1, 1)
+	d.Add(2, 2)
+	d.Add(3, 3)
+
+	// 1 is recorded again in the new window, since it is in the cache.
+	if !d.Add(1, 1) {
+		t.Fatal("add resident 1 not hit")
+	}
+	if r := d.Rejected(); r != 3 {
+		t.Fatalf("rejected %d", r)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	type id int
+	p := &struct{ n int }{1}
+	h := hashKey(p)
+	p.n = 2
+	if hashKey(p) != h {
+		t.Fatal("pointer hash changed with its target")
+	}
+	if hashKey(&struct{ n int }{2}) == h {
+		t.Fatal("distinct pointers hashed equally")
+	}
+
+	if hashKey(id(1)) != hashKey(id(1)) || hashKey(0.0) != hashKey(math.Copysign(0, -1)) {
+		t.Fatal("equal keys hashed differently")
+	}
+}
@@ -8,8 +8,7 @@ type fifo struct {
 	cache map[interface{}]*list.Element
 	list  *list.List
 
-	e     chan<- Pair
-	block bool
+	hooks
 }
 
 // NewFIFO constructs a new first-in first-out cache. Items least-recently added
@@ -35,16 +34,25 @@ func (fifo *fifo) Get(key interface{}) (value interface{}, hit bool) {
 	return
 }
 
+func (fifo *fifo) ReadOnlyGet() {}
+
 func (fifo *fifo) Add(key, value interface{}) (hit bool) {
 	if _, hit = fifo.cache[key]; hit {
 		return
 	}
 
 	if len(fifo.cache) >= fifo.capacity {
-		if item := fifo.list.Back(); item != nil {
-			send(fifo.e, fifo.block, *item.Value.(*Pair))
-			fifo.remove(item)
+		item := fifo.victim()
+		if item == nil {
+			fifo.reject(Pair{key, value})
+			return
+		}
+		victim := *item.Value.(*Pair)
+		if !fifo.admit(Pair{key, value}, victim) {
+			return
 		}
+		fifo.evict(victim)
+		fifo.remove(item)
 	}
 
 	fifo.cache[key] = fifo.list.PushFront(&Pair{key, value})
@@ -71,14 +79,65 @@ func (fifo *fifo) Delete(key interface{}) (hit bool) {
 func (fifo *fifo) Clear() {
 	fifo.cache = make(map[interface{}]*list.Element, fifo.capacity)
 	fifo.list = fifo.list.Init()
+	fifo.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (fifo *fifo) Close() error {
+	if fifo.closed {
+		return ErrClosed
+	}
+	fifo.Clear()
+	fifo.capacity = 0
+	fifo.hooks = hooks{closed: true}
+	return nil
 }
 
 func (fifo *fifo) Len() int {
 	return len(fifo.cache)
 }
 
-func (fifo *fifo) Eviction(e chan<- Pair, block bool) {
-	fifo.e, fifo.block = e, block
+func (fifo *fifo) Contains(key interface{}) (hit bool) {
+	_, hit = fifo.cache[key]
+	return
+}
+
+func (fifo *fifo) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(fifo.cache))
+	for k := range fifo.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (fifo *fifo) Cap() int {
+	return fifo.capacity
+}
+
+func (fifo *fifo) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("fifo: capacity <= 0")
+	}
+	if fifo.closed {
+		return
+	}
+
+	fifo.capacity = capacity
+	for len(fifo.cache) > capacity {
+		item := fifo.victim()
+		if item == nil {
+			break
+		}
+		fifo.evict(*item.Value.(*Pair))
+		fifo.remove(item)
+	}
+}
+
+func (fifo *fifo) Pin(key interface{}) (hit bool) {
+	if _, hit = fifo.cache[key]; hit {
+		fifo.pin(key)
+	}
+	return
 }
 
 func (fifo *fifo) Dump() []Pair {
@@ -89,7 +148,29 @@ func (fifo *fifo) Dump() []Pair {
 	return pairs
 }
 
+func (fifo *fifo) NextVictim() (victim Pair, ok bool) {
+	if item := fifo.victim(); item != nil {
+		victim, ok = *item.Value.(*Pair), true
+	}
+	return
+}
+
+// Return the next item to evict, skipping pinned items. Returns nil if every
+// item is pinned.
+func (fifo *fifo) victim() *list.Element {
+	if fifo.allPinned(len(fifo.cache)) {
+		return nil
+	}
+	item := fifo.list.Back()
+	for item != nil && fifo.pinned(item.Value.(*Pair).Key) {
+		item = item.Prev()
+	}
+	return item
+}
+
 func (fifo *fifo) remove(item *list.Element) {
-	delete(fifo.cache, item.Value.(*Pair).Key)
+	key := item.Value.(*Pair).Key
+	delete(fifo.cache, key)
+	fifo.unpinAll(key)
 	fifo.list.Remove(item)
 }
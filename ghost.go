@@ -0,0 +1,216 @@
+package cache
+
+import "container/list"
+
+// GhostList is a bounded set of keys without values, typically of recently
+// evicted items. When full, keys least-recently added are removed first. All
+// operations are O(1). A GhostList is not safe for concurrent use.
+type GhostList struct {
+	capacity int
+
+	keys map[interface{}]*list.Element
+	list *list.List
+}
+
+// NewGhostList constructs a new ghost list holding up to capacity keys. This
+// function panics if capacity <= 0.
+func NewGhostList(capacity int) *GhostList {
+	if capacity <= 0 {
+		panic("ghost: capacity <= 0")
+	}
+
+	return &GhostList{
+		capacity: capacity,
+		keys:     make(map[interface{}]*list.Element, capacity),
+		list:     list.New(),
+	}
+}
+
+// Add key to the ghost list. If the key already exists, it is moved to the
+// front as if it were newly added.
+func (g *GhostList) Add(key interface{}) {
+	if item, ok := g.keys[key]; ok {
+		g.list.MoveToFront(item)
+		return
+	}
+
+	if len(g.keys) >= g.capacity {
+		if item := g.list.Back(); item != nil {
+			delete(g.keys, item.Value)
+			g.list.Remove(item)
+		}
+	}
+
+	g.keys[key] = g.list.PushFront(key)
+}
+
+// Contains returns whether key is in the ghost list.
+func (g *GhostList) Contains(key interface{}) bool {
+	_, ok := g.keys[key]
+	return ok
+}
+
+// Remove key from the ghost list. Returns whether the key existed.
+func (g *GhostList) Remove(key interface{}) bool {
+	item, ok := g.keys[key]
+	if ok {
+		delete(g.keys, key)
+		g.list.Remove(item)
+	}
+	return ok
+}
+
+// Clear all keys in the ghost list.
+func (g *GhostList) Clear() {
+	g.keys = make(map[interface{}]*list.Element, g.capacity)
+	g.list = g.list.Init()
+}
+
+// Len returns the number of keys in the ghost list.
+func (g *GhostList) Len() int {
+	return len(g.keys)
+}
+
+// Ghosted represents a cache which remembers the keys of recently evicted
+// items.
+type Ghosted interface {
+	Closer
+
+	// GetGhost gets a value in the cache. On a miss, ghost reports whether
+	// the key was recently evicted.
+	GetGhost(key interface{}) (value interface{}, hit, ghost bool)
+
+	// GhostHits returns the number of Get misses on recently evicted keys,
+	// and the total number of Get misses. Their ratio estimates how often
+	// a slightly larger cache would have hit.
+	GhostHits() (ghosts, misses uint64)
+}
+
+type ghosted struct {
+	cache  Cache
+	ghosts *GhostList
+
+	ghostHits uint64
+	misses    uint64
+
+	e         chan<- Pair
+	block     bool
+	listeners []func(EvictionEvent)
+
+	closed bool
+}
+
+// NewGhosted wraps a cache, recording the keys of up to ghostCapacity items
+// evicted from it. The eviction channel of the input cache will be replaced by
+// a listener, and evicted pairs are passed on through the registered eviction
+// channel of the wrapper, whichever operation evicted them. While the wrapper
+// is unclosed, using the input cache is undefined behavior. Closing the wrapper
+// closes the input cache.
+func NewGhosted(cache Cache, ghostCapacity int) Ghosted {
+	g := &ghosted{
+		cache:  cache,
+		ghosts: NewGhostList(ghostCapacity),
+	}
+
+	g.cache.Eviction(nil, true)
+	g.cache.OnEvict(g.evicted)
+	return g
+}
+
+func (g *ghosted) Get(key interface{}) (value interface{}, hit bool) {
+	value, hit, _ = g.GetGhost(key)
+	return
+}
+
+func (g *ghosted) GetGhost(key interface{}) (value interface{}, hit, ghost bool) {
+	if value, hit = g.cache.Get(key); !hit {
+		g.misses++
+		if ghost = g.ghosts.Contains(key); ghost {
+			g.ghostHits++
+		}
+	}
+	return
+}
+
+func (g *ghosted) Add(key, value interface{}) (hit bool) {
+	if hit = g.cache.Add(key, value); !hit {
+		g.ghosts.Remove(key)
+	}
+	return
+}
+
+func (g *ghosted) Set(key, value interface{}) (hit bool) {
+	return g.cache.Set(key, value)
+}
+
+func (g *ghosted) Delete(key interface{}) (hit bool) {
+	return g.cache.Delete(key)
+}
+
+func (g *ghosted) Clear() {
+	g.cache.Clear()
+	g.ghosts.Clear()
+}
+
+func (g *ghosted) Len() int {
+	return g.cache.Len()
+}
+
+func (g *ghosted) Contains(key interface{}) (hit bool) {
+	return g.cache.Contains(key)
+}
+
+func (g *ghosted) Keys() []interface{} {
+	return g.cache.Keys()
+}
+
+func (g *ghosted) Cap() int {
+	return g.cache.Cap()
+}
+
+func (g *ghosted) Eviction(e chan<- Pair, block bool) {
+	g.e, g.block = e, block
+}
+
+func (g *ghosted) OnEvict(f func(EvictionEvent)) {
+	g.listeners = append(g.listeners, f)
+}
+
+func (g *ghosted) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	g.cache.Admission(a, rejected, block)
+}
+
+func (g *ghosted) Pin(key interface{}) (hit bool) {
+	return g.cache.Pin(key)
+}
+
+func (g *ghosted) Unpin(key interface{}) (hit bool) {
+	return g.cache.Unpin(key)
+}
+
+func (g *ghosted) Dump() []Pair {
+	return g.cache.Dump()
+}
+
+func (g *ghosted) GhostHits() (ghosts, misses uint64) {
+	return g.ghostHits, g.misses
+}
+
+func (g *ghosted) Close() error {
+	if g.closed {
+		return ErrClosed
+	}
+	err := g.cache.Close()
+	g.cache = closedCache()
+	g.ghosts.Clear()
+	g.e, g.listeners = nil, nil
+	g.closed = true
+	return err
+}
+
+// Record a value evicted from the input cache, and pass it on.
+func (g *ghosted) evicted(event EvictionEvent) {
+	g.ghosts.Add(event.Key)
+	send(g.e, g.block, event.Pair)
+	notify(g.listeners, event.Pair)
+}
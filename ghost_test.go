@@ -0,0 +1,86 @@
+package cache
+
+import "testing"
+
+func TestGhostList(t *testing.T) {
+	g := NewGhostList(2)
+	g.Add(1)
+	g.Add(2)
+	g.Add(3)
+
+	if g.Contains(1) {
+		t.Fatal("1 not removed")
+	}
+
+	if !g.Remove(2) || g.Contains(2) {
+		t.Fatal("remove 2")
+	}
+
+	if l := g.Len(); l != 1 {
+		t.Fatalf("len %d", l)
+	}
+}
+
+func TestGhosted(t *testing.T) {
+	evicted := make(chan Pair, 1)
+	g := NewGhosted(NewLRU(2), 2)
+	g.Eviction(evicted, false)
+
+	g.Add(1, 1)
+	g.Add(2, 2)
+	g.Add(3, 3)
+
+	if p := <-evicted; p.Key != 1 {
+		t.Fatalf("evicted %v", p.Key)
+	}
+
+	if _, hit, ghost := g.GetGhost(1); hit || !ghost {
+		t.Fatal("1 not a ghost hit")
+	}
+
+	if _, hit, ghost := g.GetGhost(4); hit || ghost {
+		t.Fatal("4 a ghost hit")
+	}
+
+	if ghosts, misses := g.GhostHits(); ghosts != 1 || misses != 2 {
+		t.Fatalf("ghost hits %d/%d", ghosts, misses)
+	}
+
+	g.Add(1, 1)
+	if _, _, ghost := g.GetGhost(1); ghost {
+		t.Fatal("1 still a ghost")
+	}
+
+	_ = g.Close()
+}
+
+func TestGhostedGetEviction(t *testing.T) {
+	evicted := make(chan Pair, 4)
+	g := NewGhosted(NewSegmentedWithOptions(SegmentedOptions{
+		EvictOut: true,
+	}, NewFIFO(2), NewLRU(1)), 4)
+	defer g.Close()
+	g.Eviction(evicted, true)
+
+	// Each promotion evicts the item it replaces, without an Add between.
+	g.Add(1, 1)
+	g.Add(2, 2)
+	g.Get(1)
+	g.Get(2)
+	g.Add(3, 3)
+	g.Add(4, 4)
+	g.Get(3)
+	g.Get(4)
+
+	if len(evicted) != 3 {
+		t.Fatalf("evicted %d", len(evicted))
+	}
+	for _, key := range []interface{}{1, 2, 3} {
+		if p := <-evicted; p.Key != key {
+			t.Fatalf("evicted %v", p.Key)
+		}
+		if _, _, ghost := g.GetGhost(key); !ghost {
+			t.Fatalf("%v not a ghost hit", key)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"reflect"
+)
+
+// Hash a key for use in probabilistic structures. Keys which are equal always
+// have equal hashes: pointers and channels are hashed by identity, other basic
+// kinds from their contents, and remaining keys, such as structs and arrays,
+// from their formatted value.
+func hashKey(key interface{}) uint64 {
+	h := fnv.New64a()
+
+	switch k := key.(type) {
+	case string:
+		_, _ = io.WriteString(h, k)
+	case int:
+		writeUint64(h, uint64(k))
+	case int64:
+		writeUint64(h, uint64(k))
+	case int32:
+		writeUint64(h, uint64(k))
+	case uint:
+		writeUint64(h, uint64(k))
+	case uint64:
+		writeUint64(h, k)
+	case uint32:
+		writeUint64(h, uint64(k))
+	case uint16:
+		writeUint64(h, uint64(k))
+	default:
+		hashValue(h, key)
+	}
+
+	// FNV mixes short inputs poorly, so finish with the SplitMix64 mixer.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Hash a key not of a common type by its kind.
+func hashValue(h hash.Hash64, key interface{}) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		// Pointer keys are equal only if they point to the same value, so
+		// the value they point to, which may change, is not hashed.
+		writeUint64(h, uint64(v.Pointer()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint64(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		writeUint64(h, v.Uint())
+	case reflect.Bool:
+		if v.Bool() {
+			writeUint64(h, 1)
+		} else {
+			writeUint64(h, 0)
+		}
+	case reflect.Float32, reflect.Float64:
+		// Negative zero equals zero.
+		f := v.Float()
+		if f == 0 {
+			f = 0
+		}
+		writeUint64(h, math.Float64bits(f))
+	case reflect.String:
+		_, _ = io.WriteString(h, v.String())
+	default:
+		_, _ = fmt.Fprintf(h, "%T:%v", key, key)
+	}
+}
+
+func writeUint64(h hash.Hash64, x uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], x)
+	_, _ = h.Write(buf[:])
+}
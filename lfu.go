@@ -10,9 +10,9 @@ type lfu struct {
 
 	cache map[interface{}]*elPair
 	list  *list.List
+	next  *elPair
 
-	e     chan<- Pair
-	block bool
+	hooks
 }
 
 type elPair struct {
@@ -56,12 +56,17 @@ func (lfu *lfu) Add(key, value interface{}) (hit bool) {
 	}
 
 	if len(lfu.cache) >= lfu.capacity {
-		if item := lfu.list.Front(); item != nil {
-			entry := item.Value.(*header).any()
-			send(lfu.e, lfu.block, entry.Pair)
-			delete(lfu.cache, entry.Key)
-			lfu.remove(item, entry)
+		entry := lfu.victim()
+		if entry == nil {
+			lfu.reject(Pair{key, value})
+			return
 		}
+		if !lfu.admit(Pair{key, value}, entry.Pair) {
+			return
+		}
+		lfu.evict(entry.Pair)
+		delete(lfu.cache, entry.Key)
+		lfu.remove(entry.el, entry)
 	}
 
 	item := &elPair{
@@ -87,6 +92,7 @@ func (lfu *lfu) Delete(key interface{}) (hit bool) {
 	var item *elPair
 	if item, hit = lfu.cache[key]; hit {
 		delete(lfu.cache, item.Key)
+		lfu.unpinAll(item.Key)
 		lfu.remove(item.el, item)
 	}
 	return
@@ -95,14 +101,67 @@ func (lfu *lfu) Delete(key interface{}) (hit bool) {
 func (lfu *lfu) Clear() {
 	lfu.cache = make(map[interface{}]*elPair, lfu.capacity)
 	lfu.list = lfu.list.Init()
+	lfu.next = nil
+	lfu.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (lfu *lfu) Close() error {
+	if lfu.closed {
+		return ErrClosed
+	}
+	lfu.Clear()
+	lfu.capacity = 0
+	lfu.hooks = hooks{closed: true}
+	return nil
 }
 
 func (lfu *lfu) Len() int {
 	return len(lfu.cache)
 }
 
-func (lfu *lfu) Eviction(e chan<- Pair, block bool) {
-	lfu.e, lfu.block = e, block
+func (lfu *lfu) Contains(key interface{}) (hit bool) {
+	_, hit = lfu.cache[key]
+	return
+}
+
+func (lfu *lfu) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(lfu.cache))
+	for k := range lfu.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (lfu *lfu) Cap() int {
+	return lfu.capacity
+}
+
+func (lfu *lfu) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("lfu: capacity <= 0")
+	}
+	if lfu.closed {
+		return
+	}
+
+	lfu.capacity = capacity
+	for len(lfu.cache) > capacity {
+		entry := lfu.victim()
+		if entry == nil {
+			break
+		}
+		lfu.evict(entry.Pair)
+		delete(lfu.cache, entry.Key)
+		lfu.remove(entry.el, entry)
+	}
+}
+
+func (lfu *lfu) Pin(key interface{}) (hit bool) {
+	if _, hit = lfu.cache[key]; hit {
+		lfu.pin(key)
+	}
+	return
 }
 
 func (lfu *lfu) Dump() []Pair {
@@ -113,14 +172,33 @@ func (lfu *lfu) Dump() []Pair {
 	return pairs
 }
 
-// Select any element from header entries. Should only be called when entries
-// exist.
-func (hdr *header) any() *elPair {
-	for entry := range hdr.entries {
-		return entry
+func (lfu *lfu) NextVictim() (victim Pair, ok bool) {
+	if entry := lfu.victim(); entry != nil {
+		victim, ok = entry.Pair, true
 	}
+	return
+}
 
-	panic("lfu: hdr: no entries")
+// Select any unpinned entry from the least-frequently-used header. Returns nil
+// if every entry is pinned. The selected entry is remembered, so that the same
+// entry is selected until it is no longer least-frequently-used.
+func (lfu *lfu) victim() *elPair {
+	if lfu.allPinned(len(lfu.cache)) {
+		return nil
+	}
+	if next := lfu.next; next != nil && lfu.cache[next.Key] == next &&
+		next.el == lfu.list.Front() && !lfu.pinned(next.Key) {
+		return next
+	}
+	for item := lfu.list.Front(); item != nil; item = item.Next() {
+		for entry := range item.Value.(*header).entries {
+			if !lfu.pinned(entry.Key) {
+				lfu.next = entry
+				return entry
+			}
+		}
+	}
+	return nil
 }
 
 func (lfu *lfu) increment(item *elPair) {
@@ -8,8 +8,7 @@ type lifo struct {
 	cache map[interface{}]*list.Element
 	list  *list.List
 
-	e     chan<- Pair
-	block bool
+	hooks
 }
 
 // NewLIFO constructs a new last-in first-out cache. Items most-recently added
@@ -35,16 +34,25 @@ func (lifo *lifo) Get(key interface{}) (value interface{}, hit bool) {
 	return
 }
 
+func (lifo *lifo) ReadOnlyGet() {}
+
 func (lifo *lifo) Add(key, value interface{}) (hit bool) {
 	if _, hit = lifo.cache[key]; hit {
 		return
 	}
 
 	if len(lifo.cache) >= lifo.capacity {
-		if item := lifo.list.Front(); item != nil {
-			send(lifo.e, lifo.block, *item.Value.(*Pair))
-			lifo.remove(item)
+		item := lifo.victim()
+		if item == nil {
+			lifo.reject(Pair{key, value})
+			return
+		}
+		victim := *item.Value.(*Pair)
+		if !lifo.admit(Pair{key, value}, victim) {
+			return
 		}
+		lifo.evict(victim)
+		lifo.remove(item)
 	}
 
 	lifo.cache[key] = lifo.list.PushFront(&Pair{key, value})
@@ -71,14 +79,65 @@ func (lifo *lifo) Delete(key interface{}) (hit bool) {
 func (lifo *lifo) Clear() {
 	lifo.cache = make(map[interface{}]*list.Element, lifo.capacity)
 	lifo.list = lifo.list.Init()
+	lifo.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (lifo *lifo) Close() error {
+	if lifo.closed {
+		return ErrClosed
+	}
+	lifo.Clear()
+	lifo.capacity = 0
+	lifo.hooks = hooks{closed: true}
+	return nil
 }
 
 func (lifo *lifo) Len() int {
 	return len(lifo.cache)
 }
 
-func (lifo *lifo) Eviction(e chan<- Pair, block bool) {
-	lifo.e, lifo.block = e, block
+func (lifo *lifo) Contains(key interface{}) (hit bool) {
+	_, hit = lifo.cache[key]
+	return
+}
+
+func (lifo *lifo) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(lifo.cache))
+	for k := range lifo.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (lifo *lifo) Cap() int {
+	return lifo.capacity
+}
+
+func (lifo *lifo) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("lifo: capacity <= 0")
+	}
+	if lifo.closed {
+		return
+	}
+
+	lifo.capacity = capacity
+	for len(lifo.cache) > capacity {
+		item := lifo.victim()
+		if item == nil {
+			break
+		}
+		lifo.evict(*item.Value.(*Pair))
+		lifo.remove(item)
+	}
+}
+
+func (lifo *lifo) Pin(key interface{}) (hit bool) {
+	if _, hit = lifo.cache[key]; hit {
+		lifo.pin(key)
+	}
+	return
 }
 
 func (lifo *lifo) Dump() []Pair {
@@ -89,7 +148,29 @@ func (lifo *lifo) Dump() []Pair {
 	return pairs
 }
 
+func (lifo *lifo) NextVictim() (victim Pair, ok bool) {
+	if item := lifo.victim(); item != nil {
+		victim, ok = *item.Value.(*Pair), true
+	}
+	return
+}
+
+// Return the next item to evict, skipping pinned items. Returns nil if every
+// item is pinned.
+func (lifo *lifo) victim() *list.Element {
+	if lifo.allPinned(len(lifo.cache)) {
+		return nil
+	}
+	item := lifo.list.Front()
+	for item != nil && lifo.pinned(item.Value.(*Pair).Key) {
+		item = item.Next()
+	}
+	return item
+}
+
 func (lifo *lifo) remove(item *list.Element) {
-	delete(lifo.cache, item.Value.(*Pair).Key)
+	key := item.Value.(*Pair).Key
+	delete(lifo.cache, key)
+	lifo.unpinAll(key)
 	lifo.list.Remove(item)
 }
@@ -0,0 +1,471 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Loader when a key does not exist in its backing
+// source, possibly wrapped. It is not reported as an error of the loader.
+var ErrNotFound = errors.New("cache: not found")
+
+// Loader loads the value of a key from a backing source, such as a database.
+type Loader func(key interface{}) (value interface{}, err error)
+
+// PanicError is reported through OnError when the loader panics during a
+// background refresh, which has no caller to receive the panic.
+type PanicError struct {
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("cache: loader panicked: %v", e.Value)
+}
+
+// Presence describes what a loading cache knows of a key.
+type Presence int
+
+const (
+	// Unknown keys are not in the cache.
+	Unknown Presence = iota
+
+	// Present keys have a value in the cache.
+	Present
+
+	// Absent keys were not found by the loader, which is cached.
+	Absent
+)
+
+// LoadingOptions configures a loading cache. The zero value loads missing
+// values and keeps them until they are evicted.
+type LoadingOptions struct {
+	// SoftTTL is the age after which a value is refreshed. The stale value
+	// is still served while a single background refresh runs. A SoftTTL <=
+	// 0 disables refreshing.
+	SoftTTL time.Duration
+
+	// HardTTL is the age after which a value is dropped, and must be loaded
+	// again. A HardTTL <= 0 keeps values until they are evicted.
+	HardTTL time.Duration
+
+	// Grace is how long a stale value is still served after a refresh of it
+	// first fails, even beyond its HardTTL.
+	Grace time.Duration
+
+	// NegativeCapacity is the number of keys not found by the loader which
+	// are remembered, so that they are not loaded again. Negative entries
+	// are kept apart from values, and cannot evict them. A NegativeCapacity
+	// <= 0 disables negative caching.
+	NegativeCapacity int
+
+	// NegativeTTL is the age after which a negative entry is dropped. A
+	// NegativeTTL <= 0 keeps negative entries until they are evicted.
+	NegativeTTL time.Duration
+
+	// OnError is called with each error other than ErrNotFound returned by
+	// the loader, whether loading or refreshing, and with a PanicError if
+	// it panics while refreshing. It is called without holding the lock of
+	// the cache.
+	OnError func(key interface{}, err error)
+
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// Loading represents a cache which loads missing values through a Loader.
+type Loading interface {
+	Closer
+
+	// Load gets the value of key, loading it on a miss. Concurrent loads of
+	// a key share a single call to the loader. Returns ErrNotFound without
+	// calling the loader if the key is cached as absent.
+	Load(key interface{}) (value interface{}, err error)
+
+	// Lookup gets the value of key without loading it, and whether the key
+	// is present, cached as absent, or unknown.
+	Lookup(key interface{}) (value interface{}, presence Presence)
+}
+
+type loading struct {
+	mu     sync.Mutex
+	cache  Cache
+	loader Loader
+	opts   LoadingOptions
+
+	stamps     map[interface{}]*stamp
+	absent     Cache
+	calls      map[interface{}]*call
+	refreshing sync.WaitGroup
+
+	closed bool
+}
+
+// stamp records when a value was loaded, when a refresh of it last failed,
+// when it expires, and whether it is being refreshed.
+type stamp struct {
+	loaded     time.Time
+	attempted  time.Time
+	expires    time.Time
+	failed     bool
+	refreshing bool
+}
+
+// call is a load in progress, shared by concurrent loads of a key. If the
+// loader panics, the panic is passed on to each load. The stamp of the key when
+// the load started tells whether it was written in the meantime.
+type call struct {
+	stamp    *stamp
+	done     chan struct{}
+	value    interface{}
+	err      error
+	panicked interface{}
+}
+
+// NewLoading wraps a cache, loading missing values through loader as
+// configured by opts. The returned cache is safe for concurrent use, and the
+// loader is called without holding its lock. Values added or set directly are
+// treated as freshly loaded. Expired values are dropped when they are next
+// accessed, so they still count towards Len until then. While the wrapper is
+// unclosed, using the input cache is undefined behavior. Closing the wrapper
+// waits for background refreshes to finish, and closes the input cache.
+func NewLoading(cache Cache, loader Loader, opts LoadingOptions) Loading {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	l := &loading{
+		cache:  cache,
+		loader: loader,
+		opts:   opts,
+		stamps: make(map[interface{}]*stamp),
+		calls:  make(map[interface{}]*call),
+		absent: closedCache(),
+	}
+
+	if opts.NegativeCapacity > 0 {
+		l.absent = NewLRU(opts.NegativeCapacity)
+	}
+
+	l.cache.OnEvict(l.evicted)
+	return l
+}
+
+func (l *loading) Load(key interface{}) (value interface{}, err error) {
+	l.mu.Lock()
+	switch value, presence := l.lookup(key); presence {
+	case Present:
+		l.mu.Unlock()
+		return value, nil
+	case Absent:
+		l.mu.Unlock()
+		return nil, ErrNotFound
+	}
+
+	c, ok := l.calls[key]
+	if !ok {
+		c = &call{stamp: l.stamps[key], done: make(chan struct{})}
+		l.calls[key] = c
+	}
+	l.mu.Unlock()
+
+	if ok {
+		<-c.done
+	} else {
+		l.load(key, c)
+		l.failed(key, c.err)
+	}
+	if c.panicked != nil {
+		panic(c.panicked)
+	}
+	return c.value, c.err
+}
+
+func (l *loading) Lookup(key interface{}) (value interface{}, presence Presence) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lookup(key)
+}
+
+func (l *loading) Get(key interface{}) (value interface{}, hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.get(key)
+}
+
+func (l *loading) Add(key, value interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(key)
+	if hit = l.cache.Add(key, value); !hit && l.cache.Contains(key) {
+		l.stamp(key)
+		_ = l.absent.Delete(key)
+	}
+	return
+}
+
+func (l *loading) Set(key, value interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(key)
+	if hit = l.cache.Set(key, value); hit {
+		l.stamp(key)
+	}
+	return
+}
+
+func (l *loading) Delete(key interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.stamps, key)
+	_ = l.absent.Delete(key)
+	return l.cache.Delete(key)
+}
+
+func (l *loading) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.Clear()
+	l.absent.Clear()
+	l.stamps = make(map[interface{}]*stamp)
+}
+
+func (l *loading) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Len()
+}
+
+func (l *loading) Contains(key interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(key)
+	return l.cache.Contains(key)
+}
+
+func (l *loading) Keys() []interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Keys()
+}
+
+func (l *loading) Cap() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Cap()
+}
+
+func (l *loading) Eviction(e chan<- Pair, block bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.Eviction(e, block)
+}
+
+func (l *loading) OnEvict(f func(EvictionEvent)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.OnEvict(f)
+}
+
+func (l *loading) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.Admission(a, rejected, block)
+}
+
+func (l *loading) Pin(key interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Pin(key)
+}
+
+func (l *loading) Unpin(key interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Unpin(key)
+}
+
+func (l *loading) Dump() []Pair {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Dump()
+}
+
+func (l *loading) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	l.refreshing.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.cache.Close()
+	_ = l.absent.Close()
+	l.cache = closedCache()
+	l.stamps = nil
+	return err
+}
+
+// Look up a value, or a negative entry which has not expired.
+func (l *loading) lookup(key interface{}) (value interface{}, presence Presence) {
+	var hit bool
+	if value, hit = l.get(key); hit {
+		return value, Present
+	}
+
+	var loaded interface{}
+	if loaded, hit = l.absent.Get(key); !hit {
+		return nil, Unknown
+	}
+	if l.opts.NegativeTTL > 0 &&
+		l.opts.Now().Sub(loaded.(time.Time)) >= l.opts.NegativeTTL {
+		_ = l.absent.Delete(key)
+		return nil, Unknown
+	}
+	return nil, Absent
+}
+
+// Get an unexpired value, starting a background refresh if it is stale.
+func (l *loading) get(key interface{}) (value interface{}, hit bool) {
+	if l.expire(key) {
+		return
+	}
+	if value, hit = l.cache.Get(key); !hit {
+		return
+	}
+
+	s := l.stamps[key]
+	if l.closed || s == nil || s.refreshing || l.opts.SoftTTL <= 0 {
+		return
+	}
+	if now := l.opts.Now(); now.Sub(s.loaded) < l.opts.SoftTTL ||
+		now.Sub(s.attempted) < l.opts.SoftTTL {
+		return
+	}
+
+	s.refreshing = true
+	l.refreshing.Add(1)
+	go l.refresh(key, s)
+	return
+}
+
+// Call the loader for key, recording its result or panic in c, and release
+// the loads waiting for it. The result is not cached if the key was written
+// while it was loading.
+func (l *loading) load(key interface{}, c *call) {
+	defer func() {
+		c.panicked = recover()
+
+		l.mu.Lock()
+		delete(l.calls, key)
+		if !l.closed && c.panicked == nil && l.stamps[key] == c.stamp {
+			switch {
+			case c.err == nil:
+				l.set(key, c.value)
+			case errors.Is(c.err, ErrNotFound):
+				l.notFound(key)
+			}
+		}
+		l.mu.Unlock()
+
+		close(c.done)
+	}()
+	c.value, c.err = l.loader(key)
+}
+
+// Reload a stale value in the background. The result is dropped if the value
+// was replaced or removed in the meantime. A failed refresh, including one in
+// which the loader panics, is not attempted again until SoftTTL has passed.
+func (l *loading) refresh(key interface{}, s *stamp) {
+	defer l.refreshing.Done()
+	value, err := l.reload(key)
+	defer l.failed(key, err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s.refreshing = false
+	if l.closed || l.stamps[key] != s {
+		return
+	}
+
+	switch {
+	case err == nil:
+		l.set(key, value)
+	case errors.Is(err, ErrNotFound):
+		delete(l.stamps, key)
+		_ = l.cache.Delete(key)
+		l.notFound(key)
+	default:
+		s.attempted = l.opts.Now()
+		if !s.failed && l.opts.HardTTL > 0 {
+			s.failed = true
+			if grace := l.opts.Now().Add(l.opts.Grace); grace.After(s.expires) {
+				s.expires = grace
+			}
+		}
+	}
+}
+
+// Call the loader, returning a panic of it as a PanicError.
+func (l *loading) reload(key interface{}) (value interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			value, err = nil, &PanicError{p}
+		}
+	}()
+	return l.loader(key)
+}
+
+// Add or set a freshly loaded value.
+func (l *loading) set(key, value interface{}) {
+	if l.cache.Set(key, value) || (!l.cache.Add(key, value) && l.cache.Contains(key)) {
+		l.stamp(key)
+		_ = l.absent.Delete(key)
+	}
+}
+
+// Record that key was not found.
+func (l *loading) notFound(key interface{}) {
+	if !l.absent.Set(key, l.opts.Now()) {
+		_ = l.absent.Add(key, l.opts.Now())
+	}
+}
+
+// Record that the value of key was just loaded.
+func (l *loading) stamp(key interface{}) {
+	now := l.opts.Now()
+	s := &stamp{loaded: now}
+	if l.opts.HardTTL > 0 {
+		s.expires = now.Add(l.opts.HardTTL)
+	}
+	l.stamps[key] = s
+}
+
+// Drop the value of key if it has expired. Returns whether it was dropped.
+func (l *loading) expire(key interface{}) bool {
+	s := l.stamps[key]
+	if s == nil || s.expires.IsZero() || l.opts.Now().Before(s.expires) {
+		return false
+	}
+	delete(l.stamps, key)
+	_ = l.cache.Delete(key)
+	return true
+}
+
+// Report an error of the loader.
+func (l *loading) failed(key interface{}, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) && l.opts.OnError != nil {
+		l.opts.OnError(key, err)
+	}
+}
+
+// Forget the stamp of an evicted value.
+func (l *loading) evicted(event EvictionEvent) {
+	delete(l.stamps, event.Key)
+}
@@ -0,0 +1,324 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Wait until the value of key in c is value.
+func waitValue(t *testing.T, c Cache, key, value interface{}) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		if v, _ := c.Get(key); v == value {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("value of %v not %v", key, value)
+}
+
+func TestLoading(t *testing.T) {
+	var calls int64
+	release := make(chan struct{})
+	l := NewLoading(NewLRU(4), func(key interface{}) (interface{}, error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return key.(int) * 10, nil
+	}, LoadingOptions{})
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := l.Load(1); v != 10 || err != nil {
+				t.Errorf("load %v %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if v, err := l.Load(1); v != 10 || err != nil {
+		t.Fatalf("load %v %v", v, err)
+	}
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("calls %d", n)
+	}
+}
+
+func TestLoadingRefresh(t *testing.T) {
+	c := &clock{now: time.Unix(0, 0)}
+	var calls int64
+	var fail int32
+	errLoad := errors.New("load failed")
+	var errs int64
+
+	l := NewLoading(NewLRU(4), func(key interface{}) (interface{}, error) {
+		n := atomic.AddInt64(&calls, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			return nil, errLoad
+		}
+		return n, nil
+	}, LoadingOptions{
+		SoftTTL: time.Second,
+		HardTTL: 5 * time.Second,
+		Grace:   10 * time.Second,
+		OnError: func(key interface{}, err error) {
+			if err == errLoad {
+				atomic.AddInt64(&errs, 1)
+			}
+		},
+		Now: c.Now,
+	})
+	defer l.Close()
+
+	if v, _ := l.Load(1); v != int64(1) {
+		t.Fatalf("load %v", v)
+	}
+
+	// The stale value is served while it is refreshed.
+	c.Advance(2 * time.Second)
+	if v, _ := l.Load(1); v != int64(1) {
+		t.Fatalf("stale load %v", v)
+	}
+	waitValue(t, l, 1, int64(2))
+
+	// A value beyond its hard TTL is loaded again.
+	c.Advance(6 * time.Second)
+	if _, hit := l.Get(1); hit {
+		t.Fatal("get expired hit")
+	}
+	if v, _ := l.Load(1); v != int64(3) {
+		t.Fatalf("load %v", v)
+	}
+
+	// A failed refresh keeps serving the stale value for the grace period.
+	atomic.StoreInt32(&fail, 1)
+	c.Advance(2 * time.Second)
+	l.Get(1)
+	for atomic.LoadInt64(&errs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(8 * time.Second)
+	if v, hit := l.Get(1); !hit || v != int64(3) {
+		t.Fatalf("get in grace %v %v", v, hit)
+	}
+	c.Advance(3 * time.Second)
+	if _, hit := l.Get(1); hit {
+		t.Fatal("get after grace hit")
+	}
+}
+
+func TestLoadingNegative(t *testing.T) {
+	c := &clock{now: time.Unix(0, 0)}
+	var calls int
+	l := NewLoading(NewLRU(1), func(key interface{}) (interface{}, error) {
+		calls++
+		if key.(int)%2 != 0 {
+			return nil, ErrNotFound
+		}
+		return key, nil
+	}, LoadingOptions{
+		NegativeCapacity: 2,
+		NegativeTTL:      time.Second,
+		Now:              c.Now,
+	})
+	defer l.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Load(1); err != ErrNotFound {
+			t.Fatalf("load %v", err)
+		}
+	}
+	if _, p := l.Lookup(1); p != Absent || calls != 1 {
+		t.Fatalf("presence %v, calls %d", p, calls)
+	}
+
+	// Negative entries do not evict values.
+	l.Load(2)
+	l.Load(3)
+	l.Load(5)
+	if v, p := l.Lookup(2); p != Present || v != 2 {
+		t.Fatalf("lookup %v %v", v, p)
+	}
+	if _, p := l.Lookup(1); p != Unknown {
+		t.Fatalf("presence %v", p)
+	}
+
+	c.Advance(time.Second)
+	if _, p := l.Lookup(3); p != Unknown {
+		t.Fatalf("presence %v", p)
+	}
+
+	l.Delete(2)
+	l.Add(5, 5)
+	if v, p := l.Lookup(5); p != Present || v != 5 {
+		t.Fatalf("lookup %v %v", v, p)
+	}
+}
+
+func TestLoadingWrappedNotFound(t *testing.T) {
+	var errs int
+	l := NewLoading(NewLRU(1), func(key interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("load %v: %w", key, ErrNotFound)
+	}, LoadingOptions{
+		NegativeCapacity: 1,
+		OnError:          func(key interface{}, err error) { errs++ },
+	})
+	defer l.Close()
+
+	if _, err := l.Load(1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("load %v", err)
+	}
+	if _, p := l.Lookup(1); p != Absent || errs != 0 {
+		t.Fatalf("presence %v, errors %d", p, errs)
+	}
+}
+
+func TestLoadingPanic(t *testing.T) {
+	var calls int64
+	release := make(chan struct{})
+	l := NewLoading(NewLRU(4), func(key interface{}) (interface{}, error) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			<-release
+			panic("load")
+		}
+		return key, nil
+	}, LoadingOptions{})
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if p := recover(); p != "load" {
+					t.Errorf("recover %v", p)
+				}
+			}()
+			l.Load(1)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if v, err := l.Load(1); v != 1 || err != nil {
+		t.Fatalf("load %v %v", v, err)
+	}
+}
+
+func TestLoadingRefreshBackoff(t *testing.T) {
+	c := &clock{now: time.Unix(0, 0)}
+	var calls int64
+	errs := make(chan error, 4)
+	l := NewLoading(NewLRU(4), func(key interface{}) (interface{}, error) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			return key, nil
+		}
+		return nil, errors.New("load failed")
+	}, LoadingOptions{
+		SoftTTL: time.Second,
+		OnError: func(key interface{}, err error) { errs <- err },
+		Now:     c.Now,
+	})
+	defer l.Close()
+
+	l.Load(1)
+	c.Advance(2 * time.Second)
+	l.Get(1)
+	<-errs
+
+	// A failed refresh is not attempted again until SoftTTL has passed.
+	l.Get(1)
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt64(&calls); n != 2 {
+		t.Fatalf("calls %d", n)
+	}
+	c.Advance(time.Second)
+	l.Get(1)
+	<-errs
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Fatalf("calls %d", n)
+	}
+}
+
+func TestLoadingRefreshPanic(t *testing.T) {
+	c := &clock{now: time.Unix(0, 0)}
+	var calls int64
+	errs := make(chan error, 1)
+	l := NewLoading(NewLRU(4), func(key interface{}) (interface{}, error) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			return key, nil
+		}
+		panic("refresh")
+	}, LoadingOptions{
+		SoftTTL: time.Second,
+		OnError: func(key interface{}, err error) { errs <- err },
+		Now:     c.Now,
+	})
+	defer l.Close()
+
+	// A panic during a refresh is reported, and the stale value kept.
+	l.Load(1)
+	c.Advance(2 * time.Second)
+	l.Get(1)
+	var perr *PanicError
+	if err := <-errs; !errors.As(err, &perr) || perr.Value != "refresh" {
+		t.Fatalf("error %v", err)
+	}
+	if v, hit := l.Get(1); !hit || v != 1 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+}
+
+func TestLoadingWritten(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	l := NewLoading(NewLRU(4), func(key interface{}) (interface{}, error) {
+		close(loading)
+		<-release
+		return "stale", nil
+	}, LoadingOptions{})
+	defer l.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Load(1)
+	}()
+	<-loading
+
+	// A value added while loading is not replaced by the loaded one.
+	l.Add(1, "fresh")
+	close(release)
+	<-done
+	if v, _ := l.Get(1); v != "fresh" {
+		t.Fatalf("get %v", v)
+	}
+}
@@ -3,20 +3,22 @@ package cache
 import "sync"
 
 type locked struct {
-	cache Cache
-	mu    sync.Mutex
+	cache    Cache
+	mu       sync.RWMutex
+	readOnly bool
 }
 
-// NewLocked wraps a cache in mutex locks.
+// NewLocked wraps a cache in mutex locks. The returned cache is Atomic, and is
+// a Previewer or Resizer if the wrapped cache is.
 func NewLocked(cache Cache) Cache {
-	return &locked{
+	return wrapLocked(&locked{
 		cache: cache,
-	}
+	})
 }
 
 func (l *locked) Get(key interface{}) (value interface{}, hit bool) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.rlock()
+	defer l.runlock()
 	return l.cache.Get(key)
 }
 
@@ -45,19 +47,161 @@ func (l *locked) Clear() {
 }
 
 func (l *locked) Len() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.rlock()
+	defer l.runlock()
 	return l.cache.Len()
 }
 
+func (l *locked) Contains(key interface{}) (hit bool) {
+	l.rlock()
+	defer l.runlock()
+	return l.cache.Contains(key)
+}
+
+func (l *locked) Keys() []interface{} {
+	l.rlock()
+	defer l.runlock()
+	return l.cache.Keys()
+}
+
+func (l *locked) Cap() int {
+	l.rlock()
+	defer l.runlock()
+	return l.cache.Cap()
+}
+
 func (l *locked) Eviction(e chan<- Pair, block bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.cache.Eviction(e, block)
 }
 
-func (l *locked) Dump() []Pair {
+func (l *locked) OnEvict(f func(EvictionEvent)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.OnEvict(f)
+}
+
+func (l *locked) Admission(a Admitter, rejected chan<- Pair, block bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.cache.Admission(a, rejected, block)
+}
+
+func (l *locked) Pin(key interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Pin(key)
+}
+
+func (l *locked) Unpin(key interface{}) (hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Unpin(key)
+}
+
+func (l *locked) Dump() []Pair {
+	l.rlock()
+	defer l.runlock()
 	return l.cache.Dump()
 }
+
+// Close closes the wrapped cache.
+func (l *locked) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.Close()
+}
+
+func (l *locked) Atomically(f func(c Cache)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f(l.cache)
+}
+
+func (l *locked) nextVictim() (victim Pair, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache.(Previewer).NextVictim()
+}
+
+func (l *locked) resize(capacity int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache.(Resizer).Resize(capacity)
+}
+
+// Return the wrapped cache, so that its type can be checked through the
+// wrapper.
+func (l *locked) unwrap() Cache {
+	return l.cache
+}
+
+// Locked caches which are Previewers or Resizers, as their wrapped caches are.
+type (
+	lockedPreviewer      struct{ *locked }
+	lockedResizer        struct{ *locked }
+	lockedPreviewResizer struct{ *locked }
+)
+
+func (l lockedPreviewer) NextVictim() (victim Pair, ok bool) {
+	return l.nextVictim()
+}
+
+func (l lockedResizer) Resize(capacity int) {
+	l.resize(capacity)
+}
+
+func (l lockedPreviewResizer) NextVictim() (victim Pair, ok bool) {
+	return l.nextVictim()
+}
+
+func (l lockedPreviewResizer) Resize(capacity int) {
+	l.resize(capacity)
+}
+
+// Return a locked cache which is a Previewer or Resizer only if its wrapped
+// cache is.
+func wrapLocked(l *locked) Cache {
+	_, previewer := l.cache.(Previewer)
+	_, resizer := l.cache.(Resizer)
+	switch {
+	case previewer && resizer:
+		return lockedPreviewResizer{l}
+	case previewer:
+		return lockedPreviewer{l}
+	case resizer:
+		return lockedResizer{l}
+	}
+	return l
+}
+
+// Return the innermost cache wrapped by NewLocked or NewRWLocked, or c itself
+// if it is not such a wrapper.
+func unwrapLocked(c Cache) Cache {
+	for {
+		w, ok := c.(interface{ unwrap() Cache })
+		if !ok {
+			return c
+		}
+		c = w.unwrap()
+	}
+}
+
+// Take the read lock if reads do not modify the wrapped cache, and the write
+// lock otherwise.
+func (l *locked) rlock() {
+	if l.readOnly {
+		l.mu.RLock()
+	} else {
+		l.mu.Lock()
+	}
+}
+
+func (l *locked) runlock() {
+	if l.readOnly {
+		l.mu.RUnlock()
+	} else {
+		l.mu.Unlock()
+	}
+}
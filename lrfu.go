@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"container/heap"
+	"math"
+)
+
+type lrfu struct {
+	capacity int
+	lambda   float64
+
+	cache map[interface{}]*crfEntry
+	heap  crfHeap
+	time  uint64
+
+	hooks
+}
+
+type crfEntry struct {
+	Pair
+	crf   float64
+	last  uint64
+	index int
+}
+
+// NewLRFU constructs a new least-recently/frequently-used cache. Items with the
+// lowest Combined Recency and Frequency (CRF) value are evicted first, as
+// described by Lee et al. in "LRFU: A Spectrum of Policies that Subsumes the
+// Least Recently Used and Least Frequently Used Policies".
+//
+// Each access contributes (1/2)^(lambda*x) to the CRF value of an item, where x
+// is the number of accesses to the cache since. Lambda must be within [0, 1]: a
+// lambda of 0 behaves as LFU, and a lambda of 1 behaves as LRU. Since all CRF
+// values decay at the same rate, they are only recomputed when their item is
+// accessed. Get, Add, and Set are O(log n).
+func NewLRFU(capacity int, lambda float64) Cache {
+	if capacity <= 0 {
+		panic("lrfu: capacity <= 0")
+	}
+
+	if lambda < 0 || lambda > 1 || math.IsNaN(lambda) {
+		panic("lrfu: lambda outside [0, 1]")
+	}
+
+	return &lrfu{
+		capacity: capacity,
+		lambda:   lambda,
+		cache:    make(map[interface{}]*crfEntry, capacity),
+		heap:     crfHeap{lambda: lambda},
+	}
+}
+
+func (lrfu *lrfu) Get(key interface{}) (value interface{}, hit bool) {
+	var item *crfEntry
+	if item, hit = lrfu.cache[key]; hit {
+		lrfu.access(item)
+		value = item.Value
+	}
+	return
+}
+
+func (lrfu *lrfu) Add(key, value interface{}) (hit bool) {
+	if _, hit = lrfu.cache[key]; hit {
+		return
+	}
+
+	if len(lrfu.cache) >= lrfu.capacity {
+		if lrfu.heap.Len() == 0 {
+			lrfu.reject(Pair{key, value})
+			return
+		}
+		if !lrfu.admit(Pair{key, value}, lrfu.heap.entries[0].Pair) {
+			return
+		}
+		item := heap.Pop(&lrfu.heap).(*crfEntry)
+		lrfu.evict(item.Pair)
+		delete(lrfu.cache, item.Key)
+	}
+
+	lrfu.time++
+	item := &crfEntry{
+		Pair: Pair{Key: key, Value: value},
+		crf:  1,
+		last: lrfu.time,
+	}
+
+	lrfu.cache[key] = item
+	heap.Push(&lrfu.heap, item)
+	return
+}
+
+func (lrfu *lrfu) Set(key, value interface{}) (hit bool) {
+	var item *crfEntry
+	if item, hit = lrfu.cache[key]; hit {
+		item.Value = value
+		lrfu.access(item)
+	}
+	return
+}
+
+func (lrfu *lrfu) Delete(key interface{}) (hit bool) {
+	var item *crfEntry
+	if item, hit = lrfu.cache[key]; hit {
+		delete(lrfu.cache, key)
+		if lrfu.pinned(key) {
+			lrfu.unpinAll(key)
+		} else {
+			heap.Remove(&lrfu.heap, item.index)
+		}
+	}
+	return
+}
+
+func (lrfu *lrfu) Clear() {
+	lrfu.cache = make(map[interface{}]*crfEntry, lrfu.capacity)
+	lrfu.heap.entries = nil
+	lrfu.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (lrfu *lrfu) Close() error {
+	if lrfu.closed {
+		return ErrClosed
+	}
+	lrfu.Clear()
+	lrfu.capacity = 0
+	lrfu.hooks = hooks{closed: true}
+	return nil
+}
+
+func (lrfu *lrfu) Len() int {
+	return len(lrfu.cache)
+}
+
+func (lrfu *lrfu) Contains(key interface{}) (hit bool) {
+	_, hit = lrfu.cache[key]
+	return
+}
+
+func (lrfu *lrfu) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(lrfu.cache))
+	for k := range lrfu.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (lrfu *lrfu) Cap() int {
+	return lrfu.capacity
+}
+
+func (lrfu *lrfu) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("lrfu: capacity <= 0")
+	}
+	if lrfu.closed {
+		return
+	}
+
+	lrfu.capacity = capacity
+	for len(lrfu.cache) > capacity && lrfu.heap.Len() > 0 {
+		item := heap.Pop(&lrfu.heap).(*crfEntry)
+		lrfu.evict(item.Pair)
+		delete(lrfu.cache, item.Key)
+	}
+}
+
+// Pinned items are removed from the heap until they are unpinned.
+func (lrfu *lrfu) Pin(key interface{}) (hit bool) {
+	var item *crfEntry
+	if item, hit = lrfu.cache[key]; hit {
+		if !lrfu.pinned(key) {
+			heap.Remove(&lrfu.heap, item.index)
+		}
+		lrfu.pin(key)
+	}
+	return
+}
+
+func (lrfu *lrfu) Unpin(key interface{}) (hit bool) {
+	if hit = lrfu.hooks.Unpin(key); hit && !lrfu.pinned(key) {
+		heap.Push(&lrfu.heap, lrfu.cache[key])
+	}
+	return
+}
+
+func (lrfu *lrfu) Dump() []Pair {
+	pairs := make([]Pair, 0, len(lrfu.cache))
+	for _, v := range lrfu.cache {
+		pairs = append(pairs, v.Pair)
+	}
+	return pairs
+}
+
+func (lrfu *lrfu) NextVictim() (victim Pair, ok bool) {
+	if lrfu.heap.Len() > 0 {
+		victim, ok = lrfu.heap.entries[0].Pair, true
+	}
+	return
+}
+
+// Recompute the CRF value of an item as of the current access.
+func (lrfu *lrfu) access(item *crfEntry) {
+	lrfu.time++
+	age := float64(lrfu.time - item.last)
+	item.crf = 1 + item.crf*math.Exp2(-lrfu.lambda*age)
+	item.last = lrfu.time
+	if !lrfu.pinned(item.Key) {
+		heap.Fix(&lrfu.heap, item.index)
+	}
+}
+
+// crfHeap is a min-heap of items ordered by their CRF value. Comparing
+// log2(crf) + lambda*last orders items by their CRF value at any common point
+// in time, without decaying every value on each access.
+type crfHeap struct {
+	lambda  float64
+	entries []*crfEntry
+}
+
+func (h *crfHeap) Len() int {
+	return len(h.entries)
+}
+
+func (h *crfHeap) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	pa := math.Log2(a.crf) + h.lambda*float64(a.last)
+	pb := math.Log2(b.crf) + h.lambda*float64(b.last)
+	if pa == pb {
+		return a.last < b.last
+	}
+	return pa < pb
+}
+
+func (h *crfHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *crfHeap) Push(x interface{}) {
+	item := x.(*crfEntry)
+	item.index = len(h.entries)
+	h.entries = append(h.entries, item)
+}
+
+func (h *crfHeap) Pop() interface{} {
+	n := len(h.entries) - 1
+	item := h.entries[n]
+	h.entries[n] = nil
+	h.entries = h.entries[:n]
+	return item
+}
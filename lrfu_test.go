@@ -0,0 +1,30 @@
+package cache
+
+import "testing"
+
+func TestLRFULambda(t *testing.T) {
+	// With lambda 1, the least-recently accessed item is evicted.
+	c := NewLRFU(2, 1)
+	c.Add(1, 1)
+	c.Get(1)
+	c.Get(1)
+	c.Add(2, 2)
+	c.Add(3, 3)
+	if _, hit := c.Get(1); hit {
+		t.Fatal("lambda 1: 1 not evicted")
+	}
+
+	// With lambda 0, the least-frequently accessed item is evicted.
+	c = NewLRFU(2, 0)
+	c.Add(1, 1)
+	c.Get(1)
+	c.Get(1)
+	c.Add(2, 2)
+	c.Add(3, 3)
+	if _, hit := c.Get(2); hit {
+		t.Fatal("lambda 0: 2 not evicted")
+	}
+	if _, hit := c.Get(1); !hit {
+		t.Fatal("lambda 0: 1 evicted")
+	}
+}
@@ -10,8 +10,7 @@ type lru struct {
 	cache map[interface{}]*list.Element
 	list  *list.List
 
-	e     chan<- Pair
-	block bool
+	hooks
 }
 
 // NewLRU constructs a new least-recently-used cache. Items which are accessed
@@ -44,10 +43,17 @@ func (lru *lru) Add(key, value interface{}) (hit bool) {
 	}
 
 	if len(lru.cache) >= lru.capacity {
-		if item := lru.list.Back(); item != nil {
-			send(lru.e, lru.block, *item.Value.(*Pair))
-			lru.remove(item)
+		item := lru.victim()
+		if item == nil {
+			lru.reject(Pair{key, value})
+			return
 		}
+		victim := *item.Value.(*Pair)
+		if !lru.admit(Pair{key, value}, victim) {
+			return
+		}
+		lru.evict(victim)
+		lru.remove(item)
 	}
 
 	lru.cache[key] = lru.list.PushFront(&Pair{key, value})
@@ -74,14 +80,65 @@ func (lru *lru) Delete(key interface{}) (hit bool) {
 func (lru *lru) Clear() {
 	lru.cache = make(map[interface{}]*list.Element, lru.capacity)
 	lru.list = lru.list.Init()
+	lru.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (lru *lru) Close() error {
+	if lru.closed {
+		return ErrClosed
+	}
+	lru.Clear()
+	lru.capacity = 0
+	lru.hooks = hooks{closed: true}
+	return nil
 }
 
 func (lru *lru) Len() int {
 	return len(lru.cache)
 }
 
-func (lru *lru) Eviction(e chan<- Pair, block bool) {
-	lru.e, lru.block = e, block
+func (lru *lru) Contains(key interface{}) (hit bool) {
+	_, hit = lru.cache[key]
+	return
+}
+
+func (lru *lru) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(lru.cache))
+	for k := range lru.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (lru *lru) Cap() int {
+	return lru.capacity
+}
+
+func (lru *lru) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("lru: capacity <= 0")
+	}
+	if lru.closed {
+		return
+	}
+
+	lru.capacity = capacity
+	for len(lru.cache) > capacity {
+		item := lru.victim()
+		if item == nil {
+			break
+		}
+		lru.evict(*item.Value.(*Pair))
+		lru.remove(item)
+	}
+}
+
+func (lru *lru) Pin(key interface{}) (hit bool) {
+	if _, hit = lru.cache[key]; hit {
+		lru.pin(key)
+	}
+	return
 }
 
 func (lru *lru) Dump() []Pair {
@@ -92,7 +149,29 @@ func (lru *lru) Dump() []Pair {
 	return pairs
 }
 
+func (lru *lru) NextVictim() (victim Pair, ok bool) {
+	if item := lru.victim(); item != nil {
+		victim, ok = *item.Value.(*Pair), true
+	}
+	return
+}
+
+// Return the next item to evict, skipping pinned items. Returns nil if every
+// item is pinned.
+func (lru *lru) victim() *list.Element {
+	if lru.allPinned(len(lru.cache)) {
+		return nil
+	}
+	item := lru.list.Back()
+	for item != nil && lru.pinned(item.Value.(*Pair).Key) {
+		item = item.Prev()
+	}
+	return item
+}
+
 func (lru *lru) remove(item *list.Element) {
-	delete(lru.cache, item.Value.(*Pair).Key)
+	key := item.Value.(*Pair).Key
+	delete(lru.cache, key)
+	lru.unpinAll(key)
 	lru.list.Remove(item)
 }
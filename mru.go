@@ -8,8 +8,7 @@ type mru struct {
 	cache map[interface{}]*list.Element
 	list  *list.List
 
-	e     chan<- Pair
-	block bool
+	hooks
 }
 
 // NewMRU constructs a new most-recently-used cache. Items which are accessed
@@ -42,10 +41,17 @@ func (mru *mru) Add(key, value interface{}) (hit bool) {
 	}
 
 	if len(mru.cache) >= mru.capacity {
-		if item := mru.list.Front(); item != nil {
-			send(mru.e, mru.block, *item.Value.(*Pair))
-			mru.remove(item)
+		item := mru.victim()
+		if item == nil {
+			mru.reject(Pair{key, value})
+			return
 		}
+		victim := *item.Value.(*Pair)
+		if !mru.admit(Pair{key, value}, victim) {
+			return
+		}
+		mru.evict(victim)
+		mru.remove(item)
 	}
 
 	mru.cache[key] = mru.list.PushFront(&Pair{key, value})
@@ -72,14 +78,65 @@ func (mru *mru) Delete(key interface{}) (hit bool) {
 func (mru *mru) Clear() {
 	mru.cache = make(map[interface{}]*list.Element, mru.capacity)
 	mru.list = mru.list.Init()
+	mru.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (mru *mru) Close() error {
+	if mru.closed {
+		return ErrClosed
+	}
+	mru.Clear()
+	mru.capacity = 0
+	mru.hooks = hooks{closed: true}
+	return nil
 }
 
 func (mru *mru) Len() int {
 	return len(mru.cache)
 }
 
-func (mru *mru) Eviction(e chan<- Pair, block bool) {
-	mru.e, mru.block = e, block
+func (mru *mru) Contains(key interface{}) (hit bool) {
+	_, hit = mru.cache[key]
+	return
+}
+
+func (mru *mru) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(mru.cache))
+	for k := range mru.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (mru *mru) Cap() int {
+	return mru.capacity
+}
+
+func (mru *mru) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("mru: capacity <= 0")
+	}
+	if mru.closed {
+		return
+	}
+
+	mru.capacity = capacity
+	for len(mru.cache) > capacity {
+		item := mru.victim()
+		if item == nil {
+			break
+		}
+		mru.evict(*item.Value.(*Pair))
+		mru.remove(item)
+	}
+}
+
+func (mru *mru) Pin(key interface{}) (hit bool) {
+	if _, hit = mru.cache[key]; hit {
+		mru.pin(key)
+	}
+	return
 }
 
 func (mru *mru) Dump() []Pair {
@@ -90,7 +147,29 @@ func (mru *mru) Dump() []Pair {
 	return pairs
 }
 
+func (mru *mru) NextVictim() (victim Pair, ok bool) {
+	if item := mru.victim(); item != nil {
+		victim, ok = *item.Value.(*Pair), true
+	}
+	return
+}
+
+// Return the next item to evict, skipping pinned items. Returns nil if every
+// item is pinned.
+func (mru *mru) victim() *list.Element {
+	if mru.allPinned(len(mru.cache)) {
+		return nil
+	}
+	item := mru.list.Front()
+	for item != nil && mru.pinned(item.Value.(*Pair).Key) {
+		item = item.Next()
+	}
+	return item
+}
+
 func (mru *mru) remove(item *list.Element) {
-	delete(mru.cache, item.Value.(*Pair).Key)
+	key := item.Value.(*Pair).Key
+	delete(mru.cache, key)
+	mru.unpinAll(key)
 	mru.list.Remove(item)
 }
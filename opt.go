@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+type opt struct {
+	capacity int
+
+	trace  []interface{}
+	uses   map[interface{}][]int
+	cursor int
+
+	cache map[interface{}]*useEntry
+	heap  useHeap
+
+	hooks
+}
+
+type useEntry struct {
+	Pair
+	next  int
+	index int
+}
+
+// NewOPT constructs a new offline optimal cache from the full sequence of keys
+// which will be accessed. Items used farthest in the future are evicted first,
+// as described by Belady in "A study of replacement algorithms for a virtual
+// storage computer". It is not a practical policy, but serves as a baseline for
+// the hit ratios of other policies on the same trace.
+//
+// A Get, Add, or Set of the key at the current position in the trace advances
+// the trace, so a Get miss followed by an Add of the same key counts as a
+// single access. Operations on other keys do not advance the trace. Items which
+// are not used again are evicted before all others. Get, Add, and Set are
+// O(log n).
+func NewOPT(capacity int, trace []interface{}) Cache {
+	if capacity <= 0 {
+		panic("opt: capacity <= 0")
+	}
+
+	o := &opt{
+		capacity: capacity,
+		trace:    trace,
+		uses:     make(map[interface{}][]int),
+		cache:    make(map[interface{}]*useEntry, capacity),
+	}
+
+	for i, key := range trace {
+		o.uses[key] = append(o.uses[key], i)
+	}
+
+	return o
+}
+
+func (o *opt) Get(key interface{}) (value interface{}, hit bool) {
+	next := o.access(key)
+	var item *useEntry
+	if item, hit = o.cache[key]; hit {
+		item.next = next
+		o.fix(item)
+		value = item.Value
+	}
+	return
+}
+
+func (o *opt) Add(key, value interface{}) (hit bool) {
+	next := o.access(key)
+	var item *useEntry
+	if item, hit = o.cache[key]; hit {
+		item.next = next
+		o.fix(item)
+		return
+	}
+
+	if len(o.cache) >= o.capacity {
+		if o.heap.Len() == 0 {
+			o.reject(Pair{key, value})
+			return
+		}
+		if !o.admit(Pair{key, value}, o.heap[0].Pair) {
+			return
+		}
+		item := heap.Pop(&o.heap).(*useEntry)
+		o.evict(item.Pair)
+		delete(o.cache, item.Key)
+	}
+
+	item = &useEntry{
+		Pair: Pair{Key: key, Value: value},
+		next: next,
+	}
+
+	o.cache[key] = item
+	heap.Push(&o.heap, item)
+	return
+}
+
+func (o *opt) Set(key, value interface{}) (hit bool) {
+	next := o.access(key)
+	var item *useEntry
+	if item, hit = o.cache[key]; hit {
+		item.Value = value
+		item.next = next
+		o.fix(item)
+	}
+	return
+}
+
+func (o *opt) Delete(key interface{}) (hit bool) {
+	var item *useEntry
+	if item, hit = o.cache[key]; hit {
+		delete(o.cache, key)
+		if o.pinned(key) {
+			o.unpinAll(key)
+		} else {
+			heap.Remove(&o.heap, item.index)
+		}
+	}
+	return
+}
+
+func (o *opt) Clear() {
+	o.cache = make(map[interface{}]*useEntry, o.capacity)
+	o.heap = nil
+	o.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (o *opt) Close() error {
+	if o.closed {
+		return ErrClosed
+	}
+	o.Clear()
+	o.capacity = 0
+	o.trace = nil
+	o.uses = nil
+	o.hooks = hooks{closed: true}
+	return nil
+}
+
+func (o *opt) Len() int {
+	return len(o.cache)
+}
+
+func (o *opt) Contains(key interface{}) (hit bool) {
+	_, hit = o.cache[key]
+	return
+}
+
+func (o *opt) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(o.cache))
+	for k := range o.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (o *opt) Cap() int {
+	return o.capacity
+}
+
+func (o *opt) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("opt: capacity <= 0")
+	}
+	if o.closed {
+		return
+	}
+
+	o.capacity = capacity
+	for len(o.cache) > capacity && o.heap.Len() > 0 {
+		item := heap.Pop(&o.heap).(*useEntry)
+		o.evict(item.Pair)
+		delete(o.cache, item.Key)
+	}
+}
+
+// Pinned items are removed from the heap until they are unpinned.
+func (o *opt) Pin(key interface{}) (hit bool) {
+	var item *useEntry
+	if item, hit = o.cache[key]; hit {
+		if !o.pinned(key) {
+			heap.Remove(&o.heap, item.index)
+		}
+		o.pin(key)
+	}
+	return
+}
+
+func (o *opt) Unpin(key interface{}) (hit bool) {
+	if hit = o.hooks.Unpin(key); hit && !o.pinned(key) {
+		heap.Push(&o.heap, o.cache[key])
+	}
+	return
+}
+
+func (o *opt) Dump() []Pair {
+	pairs := make([]Pair, 0, len(o.cache))
+	for _, v := range o.cache {
+		pairs = append(pairs, v.Pair)
+	}
+	return pairs
+}
+
+func (o *opt) NextVictim() (victim Pair, ok bool) {
+	if o.heap.Len() > 0 {
+		victim, ok = o.heap[0].Pair, true
+	}
+	return
+}
+
+// Advance the trace if key is at its current position, and return the position
+// of the next use of key.
+func (o *opt) access(key interface{}) int {
+	if o.cursor < len(o.trace) && o.trace[o.cursor] == key {
+		o.cursor++
+	}
+
+	uses := o.uses[key]
+	if i := sort.SearchInts(uses, o.cursor); i < len(uses) {
+		return uses[i]
+	}
+	return math.MaxInt
+}
+
+// Restore the heap order of an item after its next use changed.
+func (o *opt) fix(item *useEntry) {
+	if !o.pinned(item.Key) {
+		heap.Fix(&o.heap, item.index)
+	}
+}
+
+// useHeap is a max-heap of items ordered by their next use.
+type useHeap []*useEntry
+
+func (h useHeap) Len() int {
+	return len(h)
+}
+
+func (h useHeap) Less(i, j int) bool {
+	return h[i].next > h[j].next
+}
+
+func (h useHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *useHeap) Push(x interface{}) {
+	item := x.(*useEntry)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *useHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	item := old[n]
+	old[n] = nil
+	*h = old[:n]
+	return item
+}
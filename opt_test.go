@@ -0,0 +1,34 @@
+package cache
+
+import "testing"
+
+func TestOPTBaseline(t *testing.T) {
+	buf := make([]uint16, 1<<14)
+	zipfBuf(buf)
+
+	trace := make([]interface{}, len(buf))
+	for i, key := range buf {
+		trace[i] = key
+	}
+
+	const capacity = 1 << 6
+	best := hitRatio(NewOPT(capacity, trace), trace)
+
+	for _, c := range freshCaches(capacity) {
+		if ratio := hitRatio(c.cache, trace); ratio > best {
+			t.Fatalf("%s hit ratio %f exceeds OPT %f", c.name, ratio, best)
+		}
+	}
+}
+
+func hitRatio(c Cache, trace []interface{}) float64 {
+	var hits int
+	for _, key := range trace {
+		if _, hit := c.Get(key); hit {
+			hits++
+		} else {
+			c.Add(key, nil)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"io"
+	"math/rand"
+)
+
+type randomk struct {
+	capacity int
+	k        int
+
+	cache map[interface{}]int
+	list  []*timedPair
+	time  uint64
+
+	hooks
+
+	r *rand.Rand
+}
+
+type timedPair struct {
+	Pair
+	last uint64
+}
+
+// NewRandomK constructs a new random sampling cache. On eviction, k items are
+// sampled at random, with replacement, and the least-recently-used of them is
+// evicted. With a k of 2 this is the "power of two choices" policy, and as k
+// grows it approaches LRU. Random indices are read from rnd as in NewRR. This
+// function panics if k <= 0. Eviction is O(k), all other operations are O(1).
+func NewRandomK(capacity, k int, rnd io.Reader) Cache {
+	if capacity <= 0 {
+		panic("randomk: capacity <= 0")
+	}
+
+	if k <= 0 {
+		panic("randomk: k <= 0")
+	}
+
+	return &randomk{
+		capacity: capacity,
+		k:        k,
+		cache:    make(map[interface{}]int, capacity),
+		list:     make([]*timedPair, capacity),
+		r:        newRand(rnd),
+	}
+}
+
+func (rk *randomk) Get(key interface{}) (value interface{}, hit bool) {
+	var n int
+	if n, hit = rk.cache[key]; hit {
+		rk.time++
+		rk.list[n].last = rk.time
+		value = rk.list[n].Value
+	}
+	return
+}
+
+func (rk *randomk) Add(key, value interface{}) (hit bool) {
+	if _, hit = rk.cache[key]; hit {
+		return
+	}
+
+	rk.time++
+	item := &timedPair{
+		Pair: Pair{Key: key, Value: value},
+		last: rk.time,
+	}
+
+	if len(rk.cache) >= rk.capacity {
+		// Swap values with the oldest sample
+		n := rk.victim()
+		if n < 0 {
+			rk.reject(item.Pair)
+			return
+		}
+		if !rk.admit(item.Pair, rk.list[n].Pair) {
+			return
+		}
+		rk.evict(rk.list[n].Pair)
+		delete(rk.cache, rk.list[n].Key)
+		rk.list[n] = item
+		rk.cache[key] = n
+	} else {
+		rk.list[len(rk.cache)] = item
+		rk.cache[key] = len(rk.cache)
+	}
+
+	return
+}
+
+func (rk *randomk) Set(key, value interface{}) (hit bool) {
+	var n int
+	if n, hit = rk.cache[key]; hit {
+		rk.time++
+		rk.list[n].Value = value
+		rk.list[n].last = rk.time
+	}
+	return
+}
+
+func (rk *randomk) Delete(key interface{}) (hit bool) {
+	var n int
+	if n, hit = rk.cache[key]; hit {
+		delete(rk.cache, key)
+		rk.unpinAll(key)
+		rk.list[n], rk.list[len(rk.cache)] = rk.list[len(rk.cache)], nil
+		if n != len(rk.cache) {
+			rk.cache[rk.list[n].Key] = n
+		}
+	}
+	return
+}
+
+func (rk *randomk) Clear() {
+	rk.cache = make(map[interface{}]int, rk.capacity)
+	rk.list = make([]*timedPair, rk.capacity)
+	rk.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (rk *randomk) Close() error {
+	if rk.closed {
+		return ErrClosed
+	}
+	rk.Clear()
+	rk.capacity = 0
+	rk.hooks = hooks{closed: true}
+	return nil
+}
+
+func (rk *randomk) Len() int {
+	return len(rk.cache)
+}
+
+func (rk *randomk) Contains(key interface{}) (hit bool) {
+	_, hit = rk.cache[key]
+	return
+}
+
+func (rk *randomk) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(rk.cache))
+	for k := range rk.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (rk *randomk) Cap() int {
+	return rk.capacity
+}
+
+func (rk *randomk) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("randomk: capacity <= 0")
+	}
+	if rk.closed {
+		return
+	}
+
+	rk.capacity = capacity
+	for len(rk.cache) > capacity {
+		n := rk.victim()
+		if n < 0 {
+			break
+		}
+		victim := rk.list[n].Pair
+		rk.evict(victim)
+		_ = rk.Delete(victim.Key)
+	}
+
+	size := capacity
+	if len(rk.cache) > size {
+		size = len(rk.cache)
+	}
+	list := make([]*timedPair, size)
+	copy(list, rk.list[:len(rk.cache)])
+	rk.list = list
+}
+
+func (rk *randomk) Pin(key interface{}) (hit bool) {
+	if _, hit = rk.cache[key]; hit {
+		rk.pin(key)
+	}
+	return
+}
+
+func (rk *randomk) Dump() []Pair {
+	pairs := make([]Pair, 0, len(rk.cache))
+	for _, v := range rk.list[:len(rk.cache)] {
+		pairs = append(pairs, v.Pair)
+	}
+	return pairs
+}
+
+// Sample k unpinned items, and return the index of the least-recently-used of
+// them. Returns -1 if every item is pinned.
+func (rk *randomk) victim() int {
+	if rk.allPinned(len(rk.cache)) {
+		return -1
+	}
+	n := -1
+	for i := 0; i < rk.k; i++ {
+		m := drawUnpinned(rk.r, len(rk.cache), func(i int) bool {
+			return rk.pinned(rk.list[i].Key)
+		})
+		if n < 0 || rk.list[m].last < rk.list[n].last {
+			n = m
+		}
+	}
+	return n
+}
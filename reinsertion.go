@@ -0,0 +1,191 @@
+package cache
+
+import "container/list"
+
+type reinsertion struct {
+	capacity int
+
+	cache map[interface{}]*list.Element
+	list  *list.List
+
+	hooks
+}
+
+type visitedPair struct {
+	Pair
+	visited bool
+}
+
+// NewFIFOReinsertion constructs a new first-in first-out cache with
+// reinsertion, also known as second-chance or CLOCK. Items least-recently added
+// are evicted first, unless they were accessed since they were added or last
+// reinserted, in which case they are moved back to the front and given one more
+// lap. All operations are amortized O(1).
+func NewFIFOReinsertion(capacity int) Cache {
+	if capacity <= 0 {
+		panic("fifo-reinsertion: capacity <= 0")
+	}
+
+	return &reinsertion{
+		capacity: capacity,
+		cache:    make(map[interface{}]*list.Element, capacity),
+		list:     list.New(),
+	}
+}
+
+func (r *reinsertion) Get(key interface{}) (value interface{}, hit bool) {
+	var item *list.Element
+	if item, hit = r.cache[key]; hit {
+		entry := item.Value.(*visitedPair)
+		entry.visited = true
+		value = entry.Value
+	}
+	return
+}
+
+func (r *reinsertion) Add(key, value interface{}) (hit bool) {
+	if _, hit = r.cache[key]; hit {
+		return
+	}
+
+	if len(r.cache) >= r.capacity {
+		item := r.victim()
+		if item == nil {
+			r.reject(Pair{key, value})
+			return
+		}
+		victim := item.Value.(*visitedPair).Pair
+		if !r.admit(Pair{key, value}, victim) {
+			return
+		}
+		r.evict(victim)
+		r.remove(item)
+	}
+
+	r.cache[key] = r.list.PushFront(&visitedPair{
+		Pair: Pair{Key: key, Value: value},
+	})
+	return
+}
+
+func (r *reinsertion) Set(key, value interface{}) (hit bool) {
+	var item *list.Element
+	if item, hit = r.cache[key]; hit {
+		r.list.MoveToFront(item)
+		entry := item.Value.(*visitedPair)
+		entry.Value = value
+		entry.visited = false
+	}
+	return
+}
+
+func (r *reinsertion) Delete(key interface{}) (hit bool) {
+	var item *list.Element
+	if item, hit = r.cache[key]; hit {
+		r.remove(item)
+	}
+	return
+}
+
+func (r *reinsertion) Clear() {
+	r.cache = make(map[interface{}]*list.Element, r.capacity)
+	r.list = r.list.Init()
+	r.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (r *reinsertion) Close() error {
+	if r.closed {
+		return ErrClosed
+	}
+	r.Clear()
+	r.capacity = 0
+	r.hooks = hooks{closed: true}
+	return nil
+}
+
+func (r *reinsertion) Len() int {
+	return len(r.cache)
+}
+
+func (r *reinsertion) Contains(key interface{}) (hit bool) {
+	_, hit = r.cache[key]
+	return
+}
+
+func (r *reinsertion) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(r.cache))
+	for k := range r.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (r *reinsertion) Cap() int {
+	return r.capacity
+}
+
+func (r *reinsertion) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("fifo-reinsertion: capacity <= 0")
+	}
+	if r.closed {
+		return
+	}
+
+	r.capacity = capacity
+	for len(r.cache) > capacity {
+		item := r.victim()
+		if item == nil {
+			break
+		}
+		r.evict(item.Value.(*visitedPair).Pair)
+		r.remove(item)
+	}
+}
+
+func (r *reinsertion) Pin(key interface{}) (hit bool) {
+	if _, hit = r.cache[key]; hit {
+		r.pin(key)
+	}
+	return
+}
+
+func (r *reinsertion) Dump() []Pair {
+	pairs := make([]Pair, 0, len(r.cache))
+	for _, v := range r.cache {
+		pairs = append(pairs, v.Value.(*visitedPair).Pair)
+	}
+	return pairs
+}
+
+// Return the next item to evict, moving accessed items back to the front and
+// skipping pinned items. Returns nil if every item is pinned.
+func (r *reinsertion) victim() *list.Element {
+	if r.allPinned(len(r.cache)) {
+		return nil
+	}
+	item := r.list.Back()
+	for {
+		prev := item.Prev()
+		entry := item.Value.(*visitedPair)
+		if !r.pinned(entry.Key) {
+			if !entry.visited {
+				return item
+			}
+			entry.visited = false
+			r.list.MoveToFront(item)
+		}
+		if prev == nil {
+			prev = r.list.Back()
+		}
+		item = prev
+	}
+}
+
+func (r *reinsertion) remove(item *list.Element) {
+	key := item.Value.(*visitedPair).Key
+	delete(r.cache, key)
+	r.unpinAll(key)
+	r.list.Remove(item)
+}
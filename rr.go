@@ -11,9 +11,9 @@ type rr struct {
 
 	cache map[interface{}]int
 	list  []*Pair
+	next  *Pair
 
-	e     chan<- Pair
-	block bool
+	hooks
 
 	r *rand.Rand
 }
@@ -26,19 +26,12 @@ func NewRR(capacity int, rnd io.Reader) Cache {
 		panic("rr: capacity <= 0")
 	}
 
-	rr := &rr{
+	return &rr{
 		capacity: capacity,
 		cache:    make(map[interface{}]int, capacity),
 		list:     make([]*Pair, capacity),
+		r:        newRand(rnd),
 	}
-
-	if rnd == nil {
-		rr.r = rand.New(rand.NewSource(1).(rand.Source64))
-	} else {
-		rr.r = rand.New(rand.Source64(&src{rnd}))
-	}
-
-	return rr
 }
 
 func (rr *rr) Get(key interface{}) (value interface{}, hit bool) {
@@ -49,6 +42,8 @@ func (rr *rr) Get(key interface{}) (value interface{}, hit bool) {
 	return
 }
 
+func (rr *rr) ReadOnlyGet() {}
+
 func (rr *rr) Add(key, value interface{}) (hit bool) {
 	if _, hit = rr.cache[key]; hit {
 		return
@@ -58,8 +53,15 @@ func (rr *rr) Add(key, value interface{}) (hit bool) {
 
 	if len(rr.cache) >= rr.capacity {
 		// Swap values
-		n := rr.r.Intn(len(rr.cache))
-		send(rr.e, rr.block, *rr.list[n])
+		n := rr.victim()
+		if n < 0 {
+			rr.reject(*item)
+			return
+		}
+		if !rr.admit(*item, *rr.list[n]) {
+			return
+		}
+		rr.evict(*rr.list[n])
 		delete(rr.cache, rr.list[n].Key)
 		rr.list[n] = item
 		rr.cache[key] = n
@@ -83,8 +85,11 @@ func (rr *rr) Delete(key interface{}) (hit bool) {
 	var n int
 	if n, hit = rr.cache[key]; hit {
 		delete(rr.cache, key)
+		rr.unpinAll(key)
 		rr.list[n], rr.list[len(rr.cache)] = rr.list[len(rr.cache)], nil
-		rr.cache[rr.list[n].Key] = n
+		if n != len(rr.cache) {
+			rr.cache[rr.list[n].Key] = n
+		}
 	}
 	return
 }
@@ -92,24 +97,135 @@ func (rr *rr) Delete(key interface{}) (hit bool) {
 func (rr *rr) Clear() {
 	rr.cache = make(map[interface{}]int, rr.capacity)
 	rr.list = make([]*Pair, rr.capacity)
+	rr.next = nil
+	rr.pins = nil
+}
+
+// Close clears the cache, and leaves it with no capacity and no hooks.
+func (rr *rr) Close() error {
+	if rr.closed {
+		return ErrClosed
+	}
+	rr.Clear()
+	rr.capacity = 0
+	rr.hooks = hooks{closed: true}
+	return nil
 }
 
 func (rr *rr) Len() int {
 	return len(rr.cache)
 }
 
-func (rr *rr) Eviction(e chan<- Pair, block bool) {
-	rr.e, rr.block = e, block
+func (rr *rr) Contains(key interface{}) (hit bool) {
+	_, hit = rr.cache[key]
+	return
+}
+
+func (rr *rr) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(rr.cache))
+	for k := range rr.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (rr *rr) Cap() int {
+	return rr.capacity
+}
+
+func (rr *rr) Resize(capacity int) {
+	if capacity <= 0 {
+		panic("rr: capacity <= 0")
+	}
+	if rr.closed {
+		return
+	}
+
+	rr.capacity = capacity
+	for len(rr.cache) > capacity {
+		n := rr.victim()
+		if n < 0 {
+			break
+		}
+		victim := *rr.list[n]
+		rr.evict(victim)
+		_ = rr.Delete(victim.Key)
+	}
+
+	size := capacity
+	if len(rr.cache) > size {
+		size = len(rr.cache)
+	}
+	list := make([]*Pair, size)
+	copy(list, rr.list[:len(rr.cache)])
+	rr.list = list
+}
+
+func (rr *rr) Pin(key interface{}) (hit bool) {
+	if _, hit = rr.cache[key]; hit {
+		rr.pin(key)
+	}
+	return
 }
 
 func (rr *rr) Dump() []Pair {
 	pairs := make([]Pair, 0, len(rr.cache))
-	for _, v := range rr.list {
+	for _, v := range rr.list[:len(rr.cache)] {
 		pairs = append(pairs, *v)
 	}
 	return pairs
 }
 
+// NextVictim draws the random victim which the next Add to a full cache will
+// evict, as long as the victim is not deleted or pinned in the meantime.
+func (rr *rr) NextVictim() (victim Pair, ok bool) {
+	if n := rr.victim(); n >= 0 {
+		victim, ok = *rr.list[n], true
+	}
+	return
+}
+
+// Draw a random index of an item to evict, skipping pinned items. Returns -1 if
+// every item is pinned. The drawn item is remembered, so that the same item is
+// evicted until it is removed.
+func (rr *rr) victim() int {
+	if rr.allPinned(len(rr.cache)) {
+		return -1
+	}
+	if rr.next != nil && !rr.pinned(rr.next.Key) {
+		if n, ok := rr.cache[rr.next.Key]; ok && rr.list[n] == rr.next {
+			return n
+		}
+	}
+	n := drawUnpinned(rr.r, len(rr.cache), func(i int) bool {
+		return rr.pinned(rr.list[i].Key)
+	})
+	rr.next = rr.list[n]
+	return n
+}
+
+// Draw a random index below n, moving on from a pinned index to the next
+// unpinned one, so that a single number is drawn however many items are pinned.
+// Some index must be unpinned.
+func drawUnpinned(r *rand.Rand, n int, pinned func(i int) bool) int {
+	i := r.Intn(n)
+	for pinned(i) {
+		if i++; i == n {
+			i = 0
+		}
+	}
+	return i
+}
+
+// Construct a random number generator reading from rnd. If rnd is nil,
+// "math/rand" will be used.
+func newRand(rnd io.Reader) *rand.Rand {
+	if rnd == nil {
+		return rand.New(rand.NewSource(1).(rand.Source64))
+	}
+	return rand.New(rand.Source64(&src{rnd}))
+}
+
 type src struct {
 	r io.Reader
 }
@@ -0,0 +1,21 @@
+package cache
+
+// ReadOnlyGetter is implemented by caches whose Get does not modify the cache,
+// so that it may be called concurrently with other reads. The FIFO, LIFO, and
+// RR caches are ReadOnlyGetters.
+type ReadOnlyGetter interface {
+	ReadOnlyGet()
+}
+
+// NewRWLocked wraps a cache in reader/writer mutex locks. If the cache is a
+// ReadOnlyGetter, Get, Len, Contains, Keys, Cap, and Dump only take a read
+// lock, and otherwise every operation takes the write lock as with NewLocked.
+// The returned cache is Atomic, and is a Previewer or Resizer if the wrapped
+// cache is.
+func NewRWLocked(cache Cache) Cache {
+	_, readOnly := cache.(ReadOnlyGetter)
+	return wrapLocked(&locked{
+		cache:    cache,
+		readOnly: readOnly,
+	})
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRWLocked(t *testing.T) {
+	for _, c := range freshCaches(64) {
+		_, readOnly := c.cache.(ReadOnlyGetter)
+		switch c.name {
+		case "FIFO", "LIFO", "RR":
+			if !readOnly {
+				t.Fatalf("%s: not read-only", c.name)
+			}
+		default:
+			if readOnly {
+				t.Fatalf("%s: read-only", c.name)
+			}
+		}
+
+		l := NewRWLocked(c.cache)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					l.Add(i*100+j, j)
+					l.Get(j)
+					l.Len()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if n := l.Len(); n != 64 {
+			t.Fatalf("%s: len %d", c.name, n)
+		}
+	}
+}
@@ -1,65 +1,304 @@
 package cache
 
+// Segmented represents a segmented cache.
+type Segmented interface {
+	Closer
+
+	// Caps returns the capacities of the internal caches, from lowest to
+	// highest.
+	Caps() []int
+
+	// Tiers returns the statistics of the internal caches, from lowest to
+	// highest.
+	Tiers() []TierStats
+}
+
+// TierStats holds the statistics of an internal cache of a segmented cache.
+// Counts start when the segmented cache is constructed, and are not reset by
+// Clear.
+type TierStats struct {
+	Len, Cap int
+
+	// Hits counts Get hits in the internal cache.
+	Hits uint64
+
+	// Promotions counts items moved to the next higher cache, and
+	// Demotions counts items moved to the next lower cache, whether they
+	// were evicted from the internal cache or fell through it because it
+	// was full of pinned items.
+	Promotions, Demotions uint64
+
+	// Evictions counts items evicted from the segmented cache entirely.
+	Evictions uint64
+}
+
+// SegmentedOptions configures a segmented cache. The zero value gives the
+// behavior of NewSegmented.
+type SegmentedOptions struct {
+	// Thresholds holds the number of hits after which an item in each
+	// internal cache, from lowest to highest, is promoted to the next
+	// higher cache. Hits are counted from when the item entered the
+	// internal cache. Missing thresholds, and those <= 1, promote on every
+	// hit.
+	Thresholds []int
+
+	// SetAccess counts a Set hit as an access, which may promote the item
+	// as a Get hit would.
+	SetAccess bool
+
+	// AddTier is the index of the internal cache to which items are added.
+	// If it is not the lowest cache, an Add of a key in any internal cache
+	// hits instead of adding a duplicate.
+	AddTier int
+
+	// EvictOut evicts items from the segmented cache as soon as they are
+	// evicted from any internal cache, rather than demoting them to the
+	// next lower cache.
+	EvictOut bool
+
+	// Adaptive shifts capacity between the internal caches, keeping their
+	// total capacity constant. Each internal cache remembers the keys of
+	// items recently evicted or demoted from it, and as in ARC, an access
+	// of one of those keys grows that cache by one item at the expense of
+	// the nearest internal cache above its minimum capacity. Every internal
+	// cache must be a Resizer whose capacity is a number of items, so disk
+	// tiers cannot be adaptive.
+	Adaptive bool
+
+	// MinCaps and MaxCaps bound the capacities of the internal caches, from
+	// lowest to highest, in adaptive mode. Missing bounds are 1 and the
+	// total capacity.
+	MinCaps, MaxCaps []int
+}
+
 type segmented struct {
-	caches    []Cache
-	evictions []chan Pair
+	caches     []Cache
+	evicted    [][]Pair
+	rejections []chan Pair
+	opts       SegmentedOptions
+	stats      []TierStats
+
+	pins map[interface{}]int
+	hits map[interface{}]int
+
+	ghosts           []*GhostList
+	minCaps, maxCaps []int
+
+	e         chan<- Pair
+	block     bool
+	listeners []func(EvictionEvent)
+
+	closed bool
 }
 
 // NewSegmented constructs a new segmented cache. The eviction channel of the
-// input caches will be replaced. While this segmented cache is unclosed, using
-// the input caches is undefined behavior. This function panics if no caches are
-// specified.
+// input caches will be replaced by a listener. While this segmented cache is
+// unclosed, using the input caches is undefined behavior. This function panics
+// if no caches are specified.
 //
 // Arguments specified first are designated "lower" caches and hold
 // lower-priority items. Items are added to the lowest internal cache. When
 // items are accessed, they are moved to the next higher cache. When an internal
 // cache becomes full, evicted values move to the next lower cache, until being
 // completely evicted and passed through the registered eviction channel of the
-// segmented cache.
+// segmented cache. Pinned items are not moved between internal caches, and
+// items moving into an internal cache full of pinned items stay where they are
+// or fall through to the next lower cache.
 //
 // Internal caches are checked in reverse order to give higher caches the fast
-// path.
-func NewSegmented(caches ...Cache) Closer {
+// path. Closing the segmented cache closes the input caches.
+//
+// A disk tier constructed by NewDiskTier may be an internal cache, typically
+// the lowest. Its capacity is in bytes, so it is left out of Cap, and a single
+// operation may evict any number of items from it.
+func NewSegmented(caches ...Cache) Segmented {
+	return NewSegmentedWithOptions(SegmentedOptions{}, caches...)
+}
+
+// NewSegmentedWithOptions constructs a new segmented cache as NewSegmented
+// does, configured by opts. This function panics if no caches are specified,
+// if opts has more thresholds or bounds than there are caches, if opts.AddTier
+// is not the index of a cache, or if adaptive caches are not Resizers or have
+// capacities outside their bounds.
+func NewSegmentedWithOptions(opts SegmentedOptions, caches ...Cache) Segmented {
 	if len(caches) == 0 {
 		panic("segmented: no caches specified")
 	}
 
+	if len(opts.Thresholds) > len(caches) {
+		panic("segmented: more thresholds than caches")
+	}
+
+	if len(opts.MinCaps) > len(caches) || len(opts.MaxCaps) > len(caches) {
+		panic("segmented: more bounds than caches")
+	}
+
+	if opts.AddTier < 0 || opts.AddTier >= len(caches) {
+		panic("segmented: add tier out of range")
+	}
+
 	s := &segmented{
-		caches:    make([]Cache, len(caches)),
-		evictions: make([]chan Pair, len(caches)-1),
+		caches:  make([]Cache, len(caches)),
+		evicted: make([][]Pair, len(caches)),
+		opts:    opts,
+		stats:   make([]TierStats, len(caches)),
 	}
 
 	copy(s.caches, caches)
+	s.opts.Thresholds = append([]int(nil), opts.Thresholds...)
+	s.opts.MinCaps = append([]int(nil), opts.MinCaps...)
+	s.opts.MaxCaps = append([]int(nil), opts.MaxCaps...)
 
-	for i := 1; i < len(s.caches); i++ {
-		s.evictions[i-1] = make(chan Pair, 1)
-		s.caches[i].Eviction(s.evictions[i-1], true)
+	if opts.Adaptive {
+		s.adaptive()
 	}
 
+	for i, c := range s.caches {
+		i := i
+		c.Eviction(nil, true)
+		c.OnEvict(func(event EvictionEvent) {
+			s.evicted[i] = append(s.evicted[i], event.Pair)
+		})
+	}
+	s.register()
 	return s
 }
 
+// Resolve the capacity bounds of adaptive internal caches, and construct their
+// ghost lists.
+func (s *segmented) adaptive() {
+	total := s.Cap()
+	s.ghosts = make([]*GhostList, len(s.caches))
+	s.minCaps = make([]int, len(s.caches))
+	s.maxCaps = make([]int, len(s.caches))
+
+	for i, c := range s.caches {
+		if _, ok := c.(Resizer); !ok {
+			panic("segmented: adaptive cache not a Resizer")
+		}
+		if isDiskTier(c) {
+			panic("segmented: adaptive disk tier")
+		}
+
+		s.minCaps[i], s.maxCaps[i] = 1, total
+		if i < len(s.opts.MinCaps) {
+			s.minCaps[i] = s.opts.MinCaps[i]
+		}
+		if i < len(s.opts.MaxCaps) {
+			s.maxCaps[i] = s.opts.MaxCaps[i]
+		}
+
+		if n := c.Cap(); n < s.minCaps[i] || n > s.maxCaps[i] {
+			panic("segmented: capacity outside bounds")
+		}
+
+		s.ghosts[i] = NewGhostList(s.maxCaps[i])
+	}
+}
+
 func (s *segmented) Get(key interface{}) (value interface{}, hit bool) {
 	for i := len(s.caches) - 1; i >= 0; i-- {
 		if value, hit = s.caches[i].Get(key); hit {
-			if i != len(s.caches)-1 {
-				_ = s.caches[i].Delete(key)
-				_ = s.caches[i+1].Add(key, value)
-				s.trickle(i + 1)
+			s.stats[i].Hits++
+			s.adapt(i+1, key)
+			if s.promotable(i, key) {
+				s.promote(i, key, value)
 			}
-			break
+			return
 		}
 	}
+	s.adapt(0, key)
+	return
+}
+
+// Get many keys, promoting hits only once all keys are found, and trickling
+// values down the internal caches only once all hits are promoted.
+func (s *segmented) getMany(keys []interface{}) (values []interface{}, hits []bool) {
+	type promotion struct {
+		i          int
+		key, value interface{}
+	}
+
+	values = make([]interface{}, len(keys))
+	hits = make([]bool, len(keys))
+
+	var promotions []promotion
+	promoted := make(map[interface{}]bool)
+	top := len(s.caches) - 1
+
+	for n, key := range keys {
+		for i := top; i >= 0; i-- {
+			if values[n], hits[n] = s.caches[i].Get(key); hits[n] {
+				s.stats[i].Hits++
+				s.adapt(i+1, key)
+				if !promoted[key] && s.promotable(i, key) {
+					promoted[key] = true
+					promotions = append(promotions, promotion{i, key, values[n]})
+				}
+				break
+			}
+		}
+		if !hits[n] {
+			s.adapt(0, key)
+		}
+	}
+
+	if len(promotions) == 0 {
+		return
+	}
+
+	// An earlier promotion may have evicted the key of a later one, which
+	// then trickles down rather than being promoted. A promotion rejected
+	// by a cache full of pinned items returns to the cache it came from, or
+	// falls through it if promotions into it have since filled it with
+	// pinned items.
+	for _, p := range promotions {
+		if !s.caches[p.i].Delete(p.key) {
+			continue
+		}
+		if s.add(p.i+1, p.key, p.value) {
+			s.stats[p.i].Promotions++
+			continue
+		}
+		for i := p.i; !s.add(i, p.key, p.value); i-- {
+			s.stats[i].Demotions++
+		}
+	}
+
+	for i := top; i >= 0; i-- {
+		s.trickle(i)
+	}
 	return
 }
 
 func (s *segmented) Add(key, value interface{}) (hit bool) {
-	return s.caches[0].Add(key, value)
+	i := s.opts.AddTier
+	if i == 0 {
+		if hit = s.caches[0].Add(key, value); !hit {
+			s.adapt(0, key)
+		}
+		s.trickle(0)
+		return
+	}
+
+	if hit = s.Contains(key); hit {
+		return
+	}
+	s.adapt(0, key)
+	for !s.add(i, key, value) {
+		i--
+	}
+	s.trickle(i)
+	return
 }
 
 func (s *segmented) Set(key, value interface{}) (hit bool) {
 	for i := len(s.caches) - 1; i >= 0; i-- {
 		if hit = s.caches[i].Set(key, value); hit {
+			s.trickle(i)
+			if s.opts.SetAccess && s.promotable(i, key) {
+				s.promote(i, key, value)
+			}
 			break
 		}
 	}
@@ -69,6 +308,7 @@ func (s *segmented) Set(key, value interface{}) (hit bool) {
 func (s *segmented) Delete(key interface{}) (hit bool) {
 	for i := len(s.caches) - 1; i >= 0; i-- {
 		if hit = s.caches[i].Delete(key); hit {
+			s.forget(key)
 			break
 		}
 	}
@@ -79,6 +319,11 @@ func (s *segmented) Clear() {
 	for _, c := range s.caches {
 		c.Clear()
 	}
+	s.pins = nil
+	s.hits = nil
+	for _, g := range s.ghosts {
+		g.Clear()
+	}
 }
 
 func (s *segmented) Len() int {
@@ -89,8 +334,89 @@ func (s *segmented) Len() int {
 	return sum
 }
 
+func (s *segmented) Contains(key interface{}) (hit bool) {
+	for i := len(s.caches) - 1; i >= 0; i-- {
+		if hit = s.caches[i].Contains(key); hit {
+			break
+		}
+	}
+	return
+}
+
+func (s *segmented) Keys() []interface{} {
+	keys := make([]interface{}, 0, s.Len())
+	for _, c := range s.caches {
+		keys = append(keys, c.Keys()...)
+	}
+	return keys
+}
+
+// Cap returns the sum of the capacities of the internal caches, other than disk
+// tiers.
+func (s *segmented) Cap() int {
+	var sum int
+	for _, c := range s.caches {
+		if !isDiskTier(c) {
+			sum += c.Cap()
+		}
+	}
+	return sum
+}
+
+func (s *segmented) Caps() []int {
+	caps := make([]int, len(s.caches))
+	for i, c := range s.caches {
+		caps[i] = c.Cap()
+	}
+	return caps
+}
+
+func (s *segmented) Tiers() []TierStats {
+	tiers := make([]TierStats, len(s.caches))
+	copy(tiers, s.stats)
+	for i, c := range s.caches {
+		tiers[i].Len, tiers[i].Cap = c.Len(), c.Cap()
+	}
+	return tiers
+}
+
 func (s *segmented) Eviction(e chan<- Pair, block bool) {
-	s.caches[0].Eviction(e, block)
+	s.e, s.block = e, block
+}
+
+func (s *segmented) OnEvict(f func(EvictionEvent)) {
+	s.listeners = append(s.listeners, f)
+}
+
+// Admission applies to items added to, or demoted into, the lowest internal
+// cache.
+func (s *segmented) Admission(a Admitter, rejected chan<- Pair, block bool) {
+	s.caches[0].Admission(a, rejected, block)
+}
+
+func (s *segmented) Pin(key interface{}) (hit bool) {
+	for i := len(s.caches) - 1; i >= 0; i-- {
+		if hit = s.caches[i].Pin(key); hit {
+			if s.pins == nil {
+				s.pins = make(map[interface{}]int)
+			}
+			s.pins[key]++
+			break
+		}
+	}
+	return
+}
+
+func (s *segmented) Unpin(key interface{}) (hit bool) {
+	for i := len(s.caches) - 1; i >= 0; i-- {
+		if hit = s.caches[i].Unpin(key); hit {
+			if s.pins[key]--; s.pins[key] == 0 {
+				delete(s.pins, key)
+			}
+			break
+		}
+	}
+	return
 }
 
 func (s *segmented) Dump() []Pair {
@@ -102,25 +428,187 @@ func (s *segmented) Dump() []Pair {
 }
 
 func (s *segmented) Close() error {
-	s.caches[0].Eviction(nil, true)
-	for i := 1; i < len(s.caches); i++ {
-		s.caches[i].Eviction(nil, true)
-		close(s.evictions[i-1])
+	if s.closed {
+		return ErrClosed
+	}
+	var err error
+	for i, c := range s.caches {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+		if i > 0 {
+			close(s.rejections[i])
+		}
+	}
+	s.caches = []Cache{closedCache()}
+	s.evicted = make([][]Pair, 1)
+	s.rejections = make([]chan Pair, 1)
+	s.opts = SegmentedOptions{}
+	s.stats = make([]TierStats, 1)
+	s.pins = nil
+	s.hits = nil
+	s.ghosts, s.minCaps, s.maxCaps = nil, nil, nil
+	s.e, s.listeners = nil, nil
+	s.closed = true
+	return err
+}
+
+// Register rejection channels with the internal caches, which are drained after
+// each Add to them. Rejections from the lowest cache go through the registered
+// admission rejection channel of the segmented cache instead.
+func (s *segmented) register() {
+	s.rejections = make([]chan Pair, len(s.caches))
+	for i, c := range s.caches {
+		if i > 0 {
+			s.rejections[i] = make(chan Pair, 1)
+			c.Admission(nil, s.rejections[i], true)
+		}
+	}
+}
+
+// Forget the pins, hits, and ghosts of a key no longer in the segmented cache.
+func (s *segmented) forget(key interface{}) {
+	delete(s.pins, key)
+	delete(s.hits, key)
+	for _, g := range s.ghosts {
+		g.Remove(key)
 	}
-	s.caches = nil
-	s.evictions = nil
-	return nil
 }
 
-// Catch eviction values trickling down the internal caches.
+// Record a hit of key in internal cache i, and return whether the item should
+// be promoted.
+func (s *segmented) promotable(i int, key interface{}) bool {
+	if i == len(s.caches)-1 || s.pins[key] != 0 {
+		return false
+	}
+	if i >= len(s.opts.Thresholds) || s.opts.Thresholds[i] <= 1 {
+		return true
+	}
+
+	if s.hits == nil {
+		s.hits = make(map[interface{}]int)
+	}
+	if s.hits[key]++; s.hits[key] < s.opts.Thresholds[i] {
+		return false
+	}
+	delete(s.hits, key)
+	return true
+}
+
+// Move an item from internal cache i to the next higher cache, unless the
+// higher cache rejects it.
+func (s *segmented) promote(i int, key, value interface{}) {
+	_ = s.caches[i].Delete(key)
+	delete(s.hits, key)
+	if s.add(i+1, key, value) {
+		s.stats[i].Promotions++
+		s.trickle(i + 1)
+	} else {
+		_ = s.caches[i].Add(key, value)
+		s.trickle(i)
+	}
+}
+
+// Add to internal cache i. Returns false if the cache was full of pinned items
+// and rejected the value. The lowest cache is not checked, as its rejections go
+// through the registered admission rejection channel of the segmented cache.
+func (s *segmented) add(i int, key, value interface{}) bool {
+	_ = s.caches[i].Add(key, value)
+	if i == 0 {
+		return true
+	}
+	select {
+	case <-s.rejections[i]:
+		return false
+	default:
+		return true
+	}
+}
+
+// Catch the values evicted from internal cache i, of which there may be many
+// if its capacity is in bytes.
 func (s *segmented) trickle(i int) {
-	for i > 0 {
-		select {
-		case p := <-s.evictions[i-1]:
-			_ = s.caches[i-1].Add(p.Key, p.Value)
-			i--
-		default:
-			return
+	for len(s.evicted[i]) > 0 {
+		p := s.evicted[i][0]
+		s.evicted[i] = s.evicted[i][1:]
+		s.drop(i, p)
+	}
+}
+
+// Move a value evicted from internal cache i to the next lower cache, and catch
+// the values evicted in turn. Values rejected by an internal cache fall through
+// to the next lower cache, and values evicted from the lowest cache, or from
+// any cache if opts.EvictOut is set, leave the segmented cache.
+func (s *segmented) drop(i int, p Pair) {
+	if i == 0 || s.opts.EvictOut {
+		s.evict(i, p)
+		return
+	}
+
+	s.stats[i].Demotions++
+	if s.ghosts != nil {
+		s.ghosts[i].Add(p.Key)
+	}
+	delete(s.hits, p.Key)
+	for i--; !s.add(i, p.Key, p.Value); i-- {
+		s.stats[i].Demotions++
+	}
+	s.trickle(i)
+}
+
+// Evict an item from the segmented cache, out of internal cache i.
+func (s *segmented) evict(i int, p Pair) {
+	s.stats[i].Evictions++
+	if s.ghosts != nil {
+		s.ghosts[i].Add(p.Key)
+	}
+	delete(s.hits, p.Key)
+	send(s.e, s.block, p)
+	notify(s.listeners, p)
+}
+
+// Record an access of key, growing the highest internal cache from i up which
+// recently evicted or demoted it.
+func (s *segmented) adapt(i int, key interface{}) {
+	grow := -1
+	for j := len(s.ghosts) - 1; j >= i; j-- {
+		if s.ghosts[j].Remove(key) && grow < 0 {
+			grow = j
+		}
+	}
+	if grow >= 0 {
+		s.grow(grow)
+	}
+}
+
+// Grow internal cache i by one item, taking the capacity from the nearest
+// internal cache above its minimum capacity. Growing first lets the items
+// evicted by shrinking move into the grown cache.
+func (s *segmented) grow(i int) {
+	caps := s.Caps()
+	if caps[i] >= s.maxCaps[i] {
+		return
+	}
+
+	for d := 1; d < len(s.caches); d++ {
+		for _, j := range []int{i - d, i + d} {
+			if j >= 0 && j < len(s.caches) && caps[j] > s.minCaps[j] {
+				s.resize(i, caps[i]+1)
+				s.resize(j, caps[j]-1)
+				return
+			}
 		}
 	}
 }
+
+// Resize internal cache i, and catch the values it evicts.
+func (s *segmented) resize(i, capacity int) {
+	s.caches[i].(Resizer).Resize(capacity)
+	s.trickle(i)
+}
+
+// Return whether c is a disk tier, or wraps one in locks.
+func isDiskTier(c Cache) bool {
+	_, ok := unwrapLocked(c).(DiskTier)
+	return ok
+}
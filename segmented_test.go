@@ -2,6 +2,230 @@ package cache
 
 import "testing"
 
+func TestSegmentedCap(t *testing.T) {
+	s := NewSegmented(NewFIFO(2), NewLRU(3))
+	defer s.Close()
+
+	if n := s.Cap(); n != 5 {
+		t.Fatalf("cap %d", n)
+	}
+
+	if caps := s.Caps(); len(caps) != 2 || caps[0] != 2 || caps[1] != 3 {
+		t.Fatalf("caps %v", caps)
+	}
+}
+
+func TestSegmentedPin(t *testing.T) {
+	s := NewSegmented(NewFIFO(2), NewLRU(1))
+	defer s.Close()
+
+	evicted := make(chan Pair, 1)
+	s.Eviction(evicted, false)
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Get(2)
+	s.Pin(2)
+
+	// The higher cache is full of pinned items, so 1 stays where it is.
+	s.Get(1)
+	if tiers := s.Tiers(); tiers[0].Len != 1 || tiers[1].Len != 1 ||
+		tiers[0].Promotions != 1 {
+		t.Fatalf("tiers %+v", tiers)
+	}
+
+	s.Pin(1)
+	s.Unpin(2)
+	s.Add(3, 3)
+
+	// 1 is pinned, so it is not promoted, and 3 is promoted in its place,
+	// demoting 2.
+	s.Get(1)
+	s.Get(3)
+	if tiers := s.Tiers(); tiers[0].Len != 2 || tiers[1].Demotions != 1 {
+		t.Fatalf("tiers %+v", tiers)
+	}
+
+	// The lower cache is full, so 2 is evicted rather than the older but
+	// pinned 1.
+	s.Add(4, 4)
+	if p := <-evicted; p.Key != 2 {
+		t.Fatalf("evicted %v", p.Key)
+	}
+	for _, key := range []interface{}{1, 3, 4} {
+		if !s.Contains(key) {
+			t.Fatalf("%v evicted", key)
+		}
+	}
+}
+
+func TestSegmentedOptions(t *testing.T) {
+	s := NewSegmentedWithOptions(SegmentedOptions{
+		Thresholds: []int{2},
+		SetAccess:  true,
+	}, NewFIFO(2), NewLRU(1))
+	defer s.Close()
+
+	// 1 is promoted on its second hit, which is a Set.
+	s.Add(1, 1)
+	s.Get(1)
+	s.Add(2, 2)
+	s.Set(1, 10)
+	s.Add(3, 3)
+	if v, hit := s.Get(1); !hit || v != 10 {
+		t.Fatalf("get %v %v", v, hit)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("dump %v", s.Dump())
+	}
+
+	// 2 is not promoted on its first hit, and is evicted.
+	s.Get(2)
+	s.Add(4, 4)
+	if s.Contains(2) || !s.Contains(3) || !s.Contains(4) {
+		t.Fatalf("dump %v", s.Dump())
+	}
+
+	evicted := make(chan Pair, 2)
+	s = NewSegmentedWithOptions(SegmentedOptions{
+		AddTier:  1,
+		EvictOut: true,
+	}, NewFIFO(1), NewLRU(1))
+	defer s.Close()
+	s.Eviction(evicted, true)
+
+	s.Add(1, 1)
+	if !s.Add(1, 1) {
+		t.Fatal("add missed")
+	}
+
+	// 1 is evicted from the higher cache straight out of the segmented
+	// cache.
+	s.Add(2, 2)
+	if p := <-evicted; p.Key != 1 || s.Len() != 1 {
+		t.Fatalf("evicted %v, len %d", p, s.Len())
+	}
+}
+
+func TestSegmentedTiers(t *testing.T) {
+	s := NewSegmented(NewFIFO(2), NewLRU(1))
+	defer s.Close()
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Get(1)
+	s.Get(2)
+	s.Get(2)
+	s.Add(3, 3)
+	s.Add(4, 4)
+
+	// 1 and 2 were promoted, 1 was demoted, and 1 was evicted.
+	want := []TierStats{
+		{Len: 2, Cap: 2, Hits: 2, Promotions: 2, Evictions: 1},
+		{Len: 1, Cap: 1, Hits: 1, Demotions: 1},
+	}
+	tiers := s.Tiers()
+	if len(tiers) != len(want) {
+		t.Fatalf("tiers %v", tiers)
+	}
+	for i := range want {
+		if tiers[i] != want[i] {
+			t.Fatalf("tier %d: %+v", i, tiers[i])
+		}
+	}
+}
+
+func TestSegmentedFallThrough(t *testing.T) {
+	s := NewSegmentedWithOptions(SegmentedOptions{
+		AddTier: 2,
+	}, NewFIFO(2), NewLRU(1), NewLRU(1))
+	defer s.Close()
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Pin(1)
+
+	// 2 is demoted twice, falling through the cache full of pinned items.
+	s.Add(3, 3)
+	tiers := s.Tiers()
+	if tiers[0].Len != 1 || tiers[1].Demotions != 1 || tiers[2].Demotions != 2 {
+		t.Fatalf("tiers %+v", tiers)
+	}
+}
+
+func TestSegmentedAdaptive(t *testing.T) {
+	s := NewSegmentedWithOptions(SegmentedOptions{
+		Adaptive: true,
+		MaxCaps:  []int{3},
+	}, NewFIFO(2), NewLRU(2))
+	defer s.Close()
+
+	caps := func(want ...int) {
+		t.Helper()
+		got := s.Caps()
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("caps %v, want %v", got, want)
+			}
+		}
+	}
+
+	// 1 is evicted from the lower cache and accessed again, so the lower
+	// cache grows.
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Add(3, 3)
+	if _, hit := s.Get(1); hit {
+		t.Fatal("get 1 hit")
+	}
+	caps(3, 1)
+
+	// The lower cache is at its maximum capacity.
+	s.Add(4, 4)
+	s.Add(5, 5)
+	s.Get(2)
+	caps(3, 1)
+
+	// 4 is promoted, demoting 3, which is accessed again, so the higher
+	// cache grows.
+	s.Get(3)
+	s.Get(4)
+	if _, hit := s.Get(3); !hit {
+		t.Fatal("get 3 missed")
+	}
+	caps(2, 2)
+
+	if n, c := s.Len(), s.Cap(); n != 3 || c != 4 {
+		t.Fatalf("len %d, cap %d", n, c)
+	}
+}
+
+func TestSegmentedAdaptiveLocked(t *testing.T) {
+	if _, ok := NewLocked(NewBuffered(NewLRU(2))).(Resizer); ok {
+		t.Fatal("locked buffered cache is a Resizer")
+	}
+	if _, ok := NewRWLocked(NewFIFO(2)).(Resizer); !ok {
+		t.Fatal("locked FIFO cache not a Resizer")
+	}
+
+	d := newDiskTier(t, t.TempDir(), 45)
+	defer d.Close()
+	for _, c := range []Cache{NewLocked(NewBuffered(NewLRU(2))), NewLocked(d)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("adaptive %T accepted", c)
+				}
+			}()
+			NewSegmentedWithOptions(SegmentedOptions{Adaptive: true}, c, NewLRU(2))
+		}()
+	}
+
+	if s := NewSegmented(NewLocked(d), NewLRU(2)); s.Cap() != 2 {
+		t.Fatalf("cap %d", s.Cap())
+	}
+}
+
 func BenchmarkSegmented(b *testing.B) {
 	s := NewSegmented(NewFIFO(10), NewLRU(10))
 	b.ResetTimer()
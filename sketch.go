@@ -0,0 +1,73 @@
+package cache
+
+// CountMinSketch estimates the frequency of keys with a count-min sketch of
+// 4-bit counters, packed sixteen to a word. Estimates never undercount, but
+// saturate at 15. A CountMinSketch is not safe for concurrent use.
+type CountMinSketch struct {
+	table []uint64
+	width uint64
+	depth int
+}
+
+// NewCountMinSketch constructs a new count-min sketch of depth rows of width
+// counters. Width is rounded up to a power of two, and to at least 16. Wider
+// sketches overcount less often, and deeper sketches overcount by less. This
+// function panics if width <= 0 or depth <= 0.
+func NewCountMinSketch(width, depth int) *CountMinSketch {
+	if width <= 0 {
+		panic("sketch: width <= 0")
+	}
+
+	if depth <= 0 {
+		panic("sketch: depth <= 0")
+	}
+
+	w := uint64(16)
+	for w < uint64(width) {
+		w <<= 1
+	}
+
+	return &CountMinSketch{
+		table: make([]uint64, w*uint64(depth)/16),
+		width: w,
+		depth: depth,
+	}
+}
+
+// Increment the frequency of key.
+func (s *CountMinSketch) Increment(key interface{}) {
+	h := hashKey(key)
+	for i := 0; i < s.depth; i++ {
+		word, shift := s.counter(h, i)
+		if s.table[word]>>shift&0xf != 0xf {
+			s.table[word] += 1 << shift
+		}
+	}
+}
+
+// Estimate the frequency of key.
+func (s *CountMinSketch) Estimate(key interface{}) int {
+	least := uint64(0xf)
+	h := hashKey(key)
+	for i := 0; i < s.depth; i++ {
+		word, shift := s.counter(h, i)
+		if c := s.table[word] >> shift & 0xf; c < least {
+			least = c
+		}
+	}
+	return int(least)
+}
+
+// Reset halves all frequencies, so that older accesses count for less.
+func (s *CountMinSketch) Reset() {
+	for i := range s.table {
+		s.table[i] = s.table[i] >> 1 & 0x7777777777777777
+	}
+}
+
+// Return the word and shift of the counter for hash h in row i.
+func (s *CountMinSketch) counter(h uint64, i int) (word, shift uint64) {
+	h1, h2 := h&0xffffffff, h>>32|1
+	n := uint64(i)*s.width + (h1+uint64(i)*h2)&(s.width-1)
+	return n / 16, n % 16 * 4
+}
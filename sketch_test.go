@@ -0,0 +1,32 @@
+package cache
+
+import "testing"
+
+func TestCountMinSketch(t *testing.T) {
+	s := NewCountMinSketch(64, 4)
+	for i := 0; i < 8; i++ {
+		s.Increment("hot")
+	}
+	s.Increment("cold")
+
+	if e := s.Estimate("hot"); e < 8 {
+		t.Fatalf("hot estimate %d", e)
+	}
+
+	if e := s.Estimate("cold"); e < 1 || e >= 8 {
+		t.Fatalf("cold estimate %d", e)
+	}
+
+	for i := 0; i < 32; i++ {
+		s.Increment("hot")
+	}
+
+	if e := s.Estimate("hot"); e != 15 {
+		t.Fatalf("hot estimate %d not saturated", e)
+	}
+
+	s.Reset()
+	if e := s.Estimate("hot"); e != 7 {
+		t.Fatalf("hot estimate %d after reset", e)
+	}
+}